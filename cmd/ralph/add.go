@@ -21,7 +21,9 @@ var addCmd = &cobra.Command{
 Examples:
   ralph add                                    # Interactive mode
   ralph add -t "Add login form" -p 1           # Quick add with title and priority
-  ralph add -t "Feature" -a "Criterion 1" -a "Criterion 2"  # With acceptance criteria`,
+  ralph add -t "Feature" -a "Criterion 1" -a "Criterion 2"  # With acceptance criteria
+  ralph add -t "Add logout" --depends-on US-001,US-002      # With dependencies
+  ralph add -t "Add users table" --template migration      # With a per-story prompt template`,
 	RunE: runAdd,
 }
 
@@ -30,6 +32,8 @@ var (
 	addDescription        string
 	addPriority           int
 	addAcceptanceCriteria []string
+	addDependsOn          []string
+	addTemplate           string
 	addInteractive        bool
 )
 
@@ -38,6 +42,8 @@ func init() {
 	addCmd.Flags().StringVarP(&addDescription, "description", "d", "", "Story description")
 	addCmd.Flags().IntVarP(&addPriority, "priority", "p", 0, "Priority (lower = higher priority)")
 	addCmd.Flags().StringArrayVarP(&addAcceptanceCriteria, "acceptance", "a", nil, "Acceptance criteria (can be repeated)")
+	addCmd.Flags().StringSliceVar(&addDependsOn, "depends-on", nil, "IDs of stories that must pass first (comma-separated or repeated)")
+	addCmd.Flags().StringVar(&addTemplate, "template", "", "Prompt template from the prompts directory to use for this story")
 	addCmd.Flags().BoolVarP(&addInteractive, "interactive", "i", false, "Force interactive mode")
 	rootCmd.AddCommand(addCmd)
 }
@@ -79,8 +85,10 @@ func runAdd(cmd *cobra.Command, args []string) error {
 		story = prd.UserStory{
 			Title:              addTitle,
 			Description:        addDescription,
-			AcceptanceCriteria: addAcceptanceCriteria,
+			AcceptanceCriteria: prd.TextCriteria(addAcceptanceCriteria...),
 			Priority:           addPriority,
+			DependsOn:          normalizeStoryIDs(addDependsOn),
+			PromptTemplate:     addTemplate,
 			Passes:             false,
 		}
 
@@ -91,16 +99,17 @@ func runAdd(cmd *cobra.Command, args []string) error {
 
 		// Add default acceptance criteria if none provided
 		if len(story.AcceptanceCriteria) == 0 {
-			story.AcceptanceCriteria = []string{
-				"typecheck passes",
-				"tests pass",
-			}
+			story.AcceptanceCriteria = prd.TextCriteria("typecheck passes", "tests pass")
 		}
 	}
 
 	// Add story to PRD
 	p.AddStory(story)
 
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
 	// Save PRD
 	if err := p.Save(cfg.Paths.PRD); err != nil {
 		return fmt.Errorf("failed to save PRD: %w", err)
@@ -113,6 +122,12 @@ func runAdd(cmd *cobra.Command, args []string) error {
 	fmt.Printf("  Title: %s\n", addedStory.Title)
 	fmt.Printf("  Priority: %d\n", addedStory.Priority)
 	fmt.Printf("  Acceptance Criteria: %d items\n", len(addedStory.AcceptanceCriteria))
+	if len(addedStory.DependsOn) > 0 {
+		fmt.Printf("  Depends on: %s\n", strings.Join(addedStory.DependsOn, ", "))
+	}
+	if addedStory.PromptTemplate != "" {
+		fmt.Printf("  Prompt template: %s\n", addedStory.PromptTemplate)
+	}
 
 	return nil
 }
@@ -163,6 +178,14 @@ func interactiveAdd(p *prd.PRD) (prd.UserStory, error) {
 		story.Priority = priority
 	}
 
+	// Dependencies
+	fmt.Print("Depends on (comma-separated IDs, optional): ")
+	deps, err := reader.ReadString('\n')
+	if err != nil {
+		return story, err
+	}
+	story.DependsOn = parseStoryIDs(deps)
+
 	// Acceptance criteria
 	fmt.Println()
 	fmt.Println("Acceptance Criteria (enter each criterion, empty line to finish):")
@@ -179,15 +202,12 @@ func interactiveAdd(p *prd.PRD) (prd.UserStory, error) {
 		if criterion == "" {
 			break
 		}
-		story.AcceptanceCriteria = append(story.AcceptanceCriteria, criterion)
+		story.AcceptanceCriteria = append(story.AcceptanceCriteria, prd.Criterion{Text: criterion})
 	}
 
 	// Add default criteria if none provided
 	if len(story.AcceptanceCriteria) == 0 {
-		story.AcceptanceCriteria = []string{
-			"typecheck passes",
-			"tests pass",
-		}
+		story.AcceptanceCriteria = prd.TextCriteria("typecheck passes", "tests pass")
 		fmt.Println("  (Added default criteria: typecheck passes, tests pass)")
 	}
 
@@ -195,3 +215,20 @@ func interactiveAdd(p *prd.PRD) (prd.UserStory, error) {
 
 	return story, nil
 }
+
+// parseStoryIDs splits a comma-separated list of story IDs
+func parseStoryIDs(s string) []string {
+	return normalizeStoryIDs(strings.Split(s, ","))
+}
+
+// normalizeStoryIDs trims, upper-cases and drops empty story IDs
+func normalizeStoryIDs(ids []string) []string {
+	var out []string
+	for _, id := range ids {
+		id = strings.ToUpper(strings.TrimSpace(id))
+		if id != "" {
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/monitor"
+	"github.com/kylemclaren/ralph/internal/pidfile"
+	"github.com/spf13/cobra"
+)
+
+var attachCmd = &cobra.Command{
+	Use:   "attach",
+	Short: "Follow the output of a running loop",
+	Long: `Follow the live output of a running Ralph loop until it ends.
+
+Works with runs started with 'ralph run --detach', whose log is followed, and
+with runs started with --serve, whose agent output is streamed from the status
+API. Ctrl+C detaches again; the run keeps going.
+
+Examples:
+  ralph attach         # Follow from the last 20 lines
+  ralph attach -n 100  # Show more of what came before`,
+	Args: cobra.NoArgs,
+	RunE: runAttach,
+}
+
+var attachLines int
+
+func init() {
+	attachCmd.Flags().IntVarP(&attachLines, "lines", "n", 20, "Number of earlier lines to show first")
+	rootCmd.AddCommand(attachCmd)
+}
+
+func runAttach(cmd *cobra.Command, args []string) error {
+	pf := pidfile.New("")
+	running, pid := pf.IsRunning()
+	if !running {
+		return pidfile.ErrNotRunning
+	}
+	info, err := pf.ReadInfo()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	switch {
+	case info.LogPath != "":
+		color.Cyan("Attached to Ralph (PID %d, run %s). Ctrl+C to detach.", pid, info.RunID)
+		fmt.Println()
+		offset, err := printTail(info.LogPath, attachLines)
+		if err != nil {
+			return err
+		}
+		err = followLog(ctx, info.LogPath, offset, func() bool { return runActive(info.RunID) })
+		printDetachedFrom(ctx)
+		return err
+
+	case info.Addr != "":
+		color.Cyan("Attached to Ralph (PID %d) via %s. Ctrl+C to detach.", pid, info.Addr)
+		fmt.Println()
+		err := followEvents(ctx, info.Addr)
+		printDetachedFrom(ctx)
+		return err
+
+	default:
+		return fmt.Errorf("Ralph (PID %d) is running in the foreground; attach works with runs started with --detach or --serve", pid)
+	}
+}
+
+// followEvents prints the agent output streamed by the status API at addr,
+// starting with the last attachLines lines, until the run finishes
+func followEvents(ctx context.Context, addr string) error {
+	status, err := monitor.FetchStatus(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("failed to reach the status API: %w", err)
+	}
+	parallel := status.Mode == "parallel"
+
+	lines, err := monitor.FetchLines(ctx, addr, attachLines)
+	if err != nil {
+		return fmt.Errorf("failed to reach the status API: %w", err)
+	}
+	seen := 0
+	for _, line := range lines {
+		printLine(line, parallel)
+		seen = line.Seq
+	}
+
+	// The stream starts over with the output kept so far; skip what was
+	// printed already
+	reason := ""
+	err = monitor.Follow(ctx, addr, func(e monitor.Event) bool {
+		switch data := e.Data.(type) {
+		case monitor.Status:
+			if data.State == "finished" {
+				reason = data.Reason
+				return false
+			}
+		case monitor.Line:
+			if data.Seq > seen {
+				printLine(data, parallel)
+				seen = data.Seq
+			}
+		}
+		return true
+	})
+
+	if reason != "" {
+		fmt.Println()
+		color.Cyan("Run finished: %s", reason)
+	}
+	return err
+}
+
+func printLine(line monitor.Line, parallel bool) {
+	if parallel {
+		fmt.Printf("[%s] %s\n", line.StoryID, line.Text)
+		return
+	}
+	fmt.Println(line.Text)
+}
+
+// printDetachedFrom tells the user the run goes on when they pressed Ctrl+C
+func printDetachedFrom(ctx context.Context) {
+	if ctx.Err() != nil {
+		fmt.Println()
+		color.Cyan("Detached. Ralph keeps running; 'ralph attach' to follow it again.")
+	}
+}
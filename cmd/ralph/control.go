@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/control"
+	"github.com/kylemclaren/ralph/internal/pidfile"
+	"github.com/spf13/cobra"
+)
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause a running loop before its next iteration",
+	Long: `Pause a running Ralph loop. Iterations in progress finish; no new one starts
+until 'ralph resume'. 'ralph status' shows when a loop is paused.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return sendControl(control.Request{Command: control.CommandPause})
+	},
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume a paused loop",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return sendControl(control.Request{Command: control.CommandResume})
+	},
+}
+
+var skipCmd = &cobra.Command{
+	Use:   "skip [story-id]",
+	Short: "Abandon the current story and move on to the next",
+	Long: `Interrupt the agent working on a story and move on to the next one. The
+story is left pending and not picked again during this run. Changes the agent
+made in the working tree are kept; in parallel mode the story's worktree is
+discarded.
+
+In parallel mode, name the story to skip when several are in progress.
+
+Examples:
+  ralph skip          # Skip the story being worked on
+  ralph skip US-003   # Skip US-003 in parallel mode`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req := control.Request{Command: control.CommandSkip}
+		if len(args) > 0 {
+			req.Story = args[0]
+		}
+		return sendControl(req)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pauseCmd)
+	rootCmd.AddCommand(resumeCmd)
+	rootCmd.AddCommand(skipCmd)
+}
+
+// sendControl sends a request to the running loop and prints its answer
+func sendControl(req control.Request) error {
+	if running, _ := pidfile.New("").IsRunning(); !running {
+		color.Yellow("Ralph is not running")
+		return nil
+	}
+
+	msg, err := control.Send(control.Path(""), req)
+	if err != nil {
+		return err
+	}
+	color.Green(msg)
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/config"
+	"github.com/kylemclaren/ralph/internal/history"
+	"github.com/kylemclaren/ralph/internal/logfile"
+	"github.com/kylemclaren/ralph/internal/pidfile"
+	"github.com/spf13/cobra"
+)
+
+// envDetachedRun tells the background process started by --detach which run
+// ID to record its run under
+const envDetachedRun = "RALPH_DETACHED_RUN"
+
+// detachTimeout bounds how long --detach waits for the background run to
+// record itself in the PID file
+const detachTimeout = time.Minute
+
+// startupLogLines is how much of the log is shown when a detached run exits
+// during startup
+const startupLogLines = 20
+
+// detachRun starts `ralph run` again as a background process that outlives the
+// terminal, and waits until it has recorded its run in the PID file
+func detachRun(cfg *config.Config) error {
+	pf := pidfile.New("")
+	if running, pid := pf.IsRunning(); running {
+		return fmt.Errorf("%w: PID %d", pidfile.ErrAlreadyRunning, pid)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the ralph executable: %w", err)
+	}
+
+	store := history.NewStore(cfg.Paths.Runs)
+	runID := store.NewID(time.Now())
+	logPath := store.LogPath(runID)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return fmt.Errorf("failed to create run directory: %w", err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close()
+
+	child := exec.Command(exe, detachedArgs(os.Args[1:])...)
+	child.Env = append(os.Environ(), envDetachedRun+"="+runID)
+	detachProcess(child, logFile)
+	if err := child.Start(); err != nil {
+		return fmt.Errorf("failed to start background run: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- child.Wait() }()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(detachTimeout)
+	for {
+		select {
+		case err := <-exited:
+			// The run ended before it got going: nothing to do, or an error
+			printLogTail(logPath, startupLogLines)
+			if err != nil {
+				return fmt.Errorf("background run exited: %w", err)
+			}
+			return nil
+		case <-ticker.C:
+			info, err := pf.ReadInfo()
+			if err != nil || info.PID != child.Process.Pid || info.RunID == "" {
+				continue
+			}
+			if runServe != "" && info.Addr == "" {
+				continue
+			}
+			printDetached(info)
+			return nil
+		case <-timeout:
+			color.Yellow("Background run (PID %d) is still starting", child.Process.Pid)
+			fmt.Printf("  Run 'ralph logs -f %s' to follow it\n", runID)
+			return nil
+		}
+	}
+}
+
+// detachedArgs returns the arguments of this command without --detach
+func detachedArgs(args []string) []string {
+	var out []string
+	for _, arg := range args {
+		if arg == "--detach" || strings.HasPrefix(arg, "--detach=") {
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+func printDetached(info *pidfile.Info) {
+	fmt.Println()
+	color.Green("✓ Ralph is running in the background (PID %d)", info.PID)
+	fmt.Println()
+	fmt.Printf("  Run:        %s\n", info.RunID)
+	fmt.Printf("  Log:        %s\n", relPath(info.LogPath))
+	if info.Addr != "" {
+		fmt.Printf("  Dashboard:  http://%s/\n", info.Addr)
+	}
+	fmt.Println()
+	fmt.Println("  ralph attach    Follow the agent output (Ctrl+C detaches)")
+	fmt.Println("  ralph logs -f   Follow the full log")
+	fmt.Println("  ralph status    Check progress")
+	fmt.Println("  ralph stop      Stop the run")
+	fmt.Println()
+}
+
+// runDetached runs the loop in the background process started by --detach,
+// sending everything it prints to the run's rotating log
+func runDetached(cmd *cobra.Command, cfg *config.Config, runID string) error {
+	// Agents and hooks inherit the environment; a nested ralph must not
+	// think it is detached
+	os.Unsetenv(envDetachedRun)
+
+	logPath, err := filepath.Abs(history.NewStore(cfg.Paths.Runs).LogPath(runID))
+	if err != nil {
+		return err
+	}
+	restore, err := redirectOutput(logPath)
+	if err != nil {
+		return err
+	}
+
+	err = startLoop(cfg, runID, logPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	restore()
+
+	// Already logged; there is no terminal to print usage to
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	return err
+}
+
+// redirectOutput points stdout and stderr, including colored output, at a
+// rotating log and returns a function that restores them. A pipe is used
+// since the log file changes on rotation.
+func redirectOutput(path string) (func(), error) {
+	w, err := logfile.Open(path, logfile.DefaultMaxBytes, logfile.DefaultKeep)
+	if err != nil {
+		return nil, err
+	}
+	r, pw, err := os.Pipe()
+	if err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to redirect output: %w", err)
+	}
+
+	stdout, stderr := os.Stdout, os.Stderr
+	colorOut, colorErr := color.Output, color.Error
+	os.Stdout, os.Stderr = pw, pw
+	color.Output, color.Error = pw, pw
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(w, r)
+		close(done)
+	}()
+
+	return func() {
+		os.Stdout, os.Stderr = stdout, stderr
+		color.Output, color.Error = colorOut, colorErr
+		pw.Close()
+		// A process left behind by the agent may still hold the pipe open
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+		}
+		r.Close()
+		w.Close()
+	}, nil
+}
+
+// relPath shortens path relative to the working directory when it is inside it
+func relPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess starts cmd in a new session, so it keeps running when the
+// terminal closes, with anything it prints before taking over its log going
+// to log
+func detachProcess(cmd *exec.Cmd, log *os.File) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Stdout = log
+	cmd.Stderr = log
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// detachedProcess is the DETACHED_PROCESS creation flag
+const detachedProcess = 0x00000008
+
+// detachProcess starts cmd without a console, so it keeps running when the
+// terminal closes. Its output is not sent to log: Windows cannot rename a file
+// another process holds open, which rotating the log needs.
+func detachProcess(cmd *exec.Cmd, log *os.File) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess,
+	}
+}
@@ -21,7 +21,11 @@ var editCmd = &cobra.Command{
 Examples:
   ralph edit US-001                    # Interactive edit
   ralph edit US-001 -t "New title"     # Update title only
-  ralph edit US-001 -p 1               # Update priority only`,
+  ralph edit US-001 -p 1               # Update priority only
+  ralph edit US-003 --depends-on US-001,US-002  # Replace dependencies
+  ralph edit US-003 --depends-on ""    # Clear dependencies
+  ralph edit US-004 --template ui      # Render US-004 with .ralph/prompts/ui.md
+  ralph edit US-004 --template ""      # Use the main prompt again`,
 	Args: cobra.ExactArgs(1),
 	RunE: runEdit,
 }
@@ -31,6 +35,8 @@ var (
 	editDescription string
 	editPriority    int
 	editNotes       string
+	editDependsOn   []string
+	editTemplate    string
 )
 
 func init() {
@@ -38,6 +44,8 @@ func init() {
 	editCmd.Flags().StringVarP(&editDescription, "description", "d", "", "New description")
 	editCmd.Flags().IntVarP(&editPriority, "priority", "p", 0, "New priority")
 	editCmd.Flags().StringVarP(&editNotes, "notes", "n", "", "New notes")
+	editCmd.Flags().StringSliceVar(&editDependsOn, "depends-on", nil, "Replace dependencies (comma-separated story IDs)")
+	editCmd.Flags().StringVar(&editTemplate, "template", "", "Prompt template from the prompts directory (\"\" for the main prompt)")
 	rootCmd.AddCommand(editCmd)
 }
 
@@ -63,7 +71,9 @@ func runEdit(cmd *cobra.Command, args []string) error {
 	}
 
 	// Check if any flags were provided
-	flagsProvided := editTitle != "" || editDescription != "" || editPriority != 0 || editNotes != ""
+	dependsOnChanged := cmd.Flags().Changed("depends-on")
+	templateChanged := cmd.Flags().Changed("template")
+	flagsProvided := editTitle != "" || editDescription != "" || editPriority != 0 || editNotes != "" || dependsOnChanged || templateChanged
 
 	if flagsProvided {
 		// Update from flags
@@ -79,6 +89,12 @@ func runEdit(cmd *cobra.Command, args []string) error {
 		if editNotes != "" {
 			story.Notes = editNotes
 		}
+		if dependsOnChanged {
+			story.DependsOn = normalizeStoryIDs(editDependsOn)
+		}
+		if templateChanged {
+			story.PromptTemplate = editTemplate
+		}
 	} else {
 		// Interactive edit
 		if err := interactiveEdit(story); err != nil {
@@ -86,6 +102,10 @@ func runEdit(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
 	// Save PRD
 	if err := p.Save(cfg.Paths.PRD); err != nil {
 		return fmt.Errorf("failed to save PRD: %w", err)
@@ -132,6 +152,13 @@ func interactiveEdit(story *prd.UserStory) error {
 		}
 	}
 
+	// Dependencies
+	fmt.Printf("Depends on [%s]: ", strings.Join(story.DependsOn, ", "))
+	deps, _ := reader.ReadString('\n')
+	if strings.TrimSpace(deps) != "" {
+		story.DependsOn = parseStoryIDs(deps)
+	}
+
 	// Notes
 	fmt.Printf("Notes [%s]: ", story.Notes)
 	notes, _ := reader.ReadString('\n')
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/config"
+	"github.com/kylemclaren/ralph/internal/history"
+	"github.com/kylemclaren/ralph/internal/prd"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Inspect past Ralph runs",
+	Long: `Inspect the run history recorded under .ralph/runs/.
+
+Every 'ralph run' records its metadata, and each iteration's status, the
+prompt it was given, its full agent output, and the PRD before and after the
+iteration.
+
+Use "latest" as the run ID to refer to the most recent run.
+
+Examples:
+  ralph history                      # List recorded runs
+  ralph history show latest          # Show the iterations of the latest run
+  ralph history show latest 3        # Show iteration 3 with its agent transcript
+  ralph history diff latest 3        # Show PRD changes made during iteration 3`,
+	Args: cobra.NoArgs,
+	RunE: runHistoryList,
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show <run-id> [iteration]",
+	Short: "Show a run, or one iteration's transcript",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE:  runHistoryShow,
+}
+
+var historyDiffCmd = &cobra.Command{
+	Use:   "diff <run-id> <iteration>",
+	Short: "Show PRD changes made during an iteration",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runHistoryDiff,
+}
+
+var historyLimit int
+
+func init() {
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "l", 20, "Maximum number of runs to list (0 for all)")
+	historyCmd.AddCommand(historyShowCmd)
+	historyCmd.AddCommand(historyDiffCmd)
+	rootCmd.AddCommand(historyCmd)
+}
+
+func historyStore() *history.Store {
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+	return history.NewStore(cfg.Paths.Runs)
+}
+
+func runHistoryList(cmd *cobra.Command, args []string) error {
+	runs, err := historyStore().List()
+	if err != nil {
+		return err
+	}
+
+	if len(runs) == 0 {
+		color.Yellow("No runs recorded yet. Run 'ralph run' to start one.")
+		return nil
+	}
+
+	if historyLimit > 0 && len(runs) > historyLimit {
+		runs = runs[:historyLimit]
+	}
+
+	fmt.Println()
+	fmt.Printf("  %-18s  %-16s  %-8s  %9s  %5s  %7s  %s\n", "RUN", "STARTED", "MODE", "DURATION", "ITERS", "STORIES", "RESULT")
+	fmt.Println("  " + strings.Repeat("─", 84))
+	for _, r := range runs {
+		fmt.Printf("  %-18s  %-16s  %-8s  %9s  %5d  %7d  %s\n",
+			r.ID,
+			r.StartedAt.Format("2006-01-02 15:04"),
+			r.Mode,
+			r.Duration().Round(time.Second),
+			r.Iterations,
+			r.StoriesComplete,
+			runOutcome(r))
+	}
+	fmt.Println()
+
+	return nil
+}
+
+func runHistoryShow(cmd *cobra.Command, args []string) error {
+	run, err := historyStore().Get(args[0])
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 2 {
+		n, err := parseIteration(args[1])
+		if err != nil {
+			return err
+		}
+		return showIteration(run, n)
+	}
+
+	fmt.Println()
+	color.Cyan("Run %s", run.ID)
+	fmt.Println()
+	fmt.Printf("  Started:    %s\n", run.StartedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Duration:   %s\n", run.Duration().Round(time.Second))
+	fmt.Printf("  Mode:       %s\n", run.Mode)
+	fmt.Printf("  Agent:      %s\n", run.Agent)
+	fmt.Printf("  Branch:     %s\n", run.Branch)
+	fmt.Printf("  Iterations: %d/%d\n", run.Iterations, run.MaxIterations)
+	fmt.Printf("  Stories:    %d complete\n", run.StoriesComplete)
+	if run.Usage != nil {
+		fmt.Printf("  Spend:      %s\n", run.Usage)
+	}
+	fmt.Printf("  Result:     %s\n", runOutcome(run))
+	if run.Error != "" {
+		fmt.Printf("  Error:      %s\n", color.RedString(run.Error))
+	}
+	fmt.Println()
+
+	iterations, err := run.LoadIterations()
+	if err != nil {
+		return err
+	}
+	if len(iterations) == 0 {
+		color.Yellow("  No iterations recorded.")
+		return nil
+	}
+
+	fmt.Printf("  %4s  %-10s  %-12s  %9s  %4s  %s\n", "#", "STORY", "STATUS", "DURATION", "EXIT", "MESSAGE")
+	fmt.Println("  " + strings.Repeat("─", 70))
+	for _, it := range iterations {
+		fmt.Printf("  %4d  %-10s  %-12s  %9s  %4d  %s\n",
+			it.Number,
+			it.StoryID,
+			statusColor(fmt.Sprintf("%-12s", it.Status)),
+			it.Duration().Round(time.Second),
+			it.ExitCode,
+			it.Message)
+	}
+	fmt.Println()
+
+	return nil
+}
+
+func showIteration(run *history.Run, n int) error {
+	it, err := run.LoadIteration(n)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	color.Cyan("Run %s, iteration %d", run.ID, it.Number)
+	fmt.Println()
+	fmt.Printf("  Story:    %s - %s\n", it.StoryID, it.StoryTitle)
+	if it.Branch != "" {
+		fmt.Printf("  Branch:   %s\n", it.Branch)
+	}
+	fmt.Printf("  Started:  %s\n", it.StartedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Duration: %s\n", it.Duration().Round(time.Second))
+	fmt.Printf("  Status:   %s\n", statusColor(it.Status))
+	fmt.Printf("  Exit:     %d\n", it.ExitCode)
+	if it.Usage != nil {
+		fmt.Printf("  Spend:    %s\n", it.Usage)
+	}
+	if promptPath := filepath.Join(run.IterationDir(n), history.PromptFile); fileExists(promptPath) {
+		fmt.Printf("  Prompt:   %s\n", promptPath)
+	}
+	if it.Message != "" {
+		fmt.Printf("  Message:  %s\n", it.Message)
+	}
+	if it.Error != "" {
+		fmt.Printf("  Error:    %s\n", color.RedString(it.Error))
+	}
+	fmt.Println()
+
+	if len(it.Hooks) > 0 {
+		color.Cyan("Hooks:")
+		for _, h := range it.Hooks {
+			mark := color.GreenString("✓")
+			switch {
+			case h.Ignored:
+				mark = color.YellowString("⚠")
+			case h.Error != "":
+				mark = color.RedString("✗")
+			}
+			fmt.Printf("  %s %s: %s (%s)\n", mark, h.Hook, h.Command, h.Duration.Round(time.Millisecond))
+			if h.Error != "" {
+				fmt.Printf("    %s\n", h.Error)
+			}
+			if out := strings.TrimSpace(h.Output); out != "" {
+				for _, line := range strings.Split(out, "\n") {
+					fmt.Printf("    %s\n", color.HiBlackString(line))
+				}
+			}
+		}
+		fmt.Println()
+	}
+
+	output, err := run.ReadIterationFile(n, history.OutputFile)
+	if err != nil {
+		return err
+	}
+
+	color.Cyan("Agent output:")
+	fmt.Println(strings.Repeat("─", 60))
+	fmt.Println(string(output))
+	return nil
+}
+
+func runHistoryDiff(cmd *cobra.Command, args []string) error {
+	run, err := historyStore().Get(args[0])
+	if err != nil {
+		return err
+	}
+
+	n, err := parseIteration(args[1])
+	if err != nil {
+		return err
+	}
+
+	before, err := loadSnapshot(run, n, history.PRDBeforeFile)
+	if err != nil {
+		return err
+	}
+	after, err := loadSnapshot(run, n, history.PRDAfterFile)
+	if err != nil {
+		return err
+	}
+
+	changes := prd.Diff(before, after)
+	if len(changes) == 0 {
+		color.Yellow("No PRD changes in iteration %d", n)
+		return nil
+	}
+
+	for _, c := range changes {
+		line := c.String()
+		switch c.Field {
+		case "added":
+			fmt.Println(color.GreenString(line))
+		case "removed":
+			fmt.Println(color.RedString(line))
+		default:
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
+
+func loadSnapshot(run *history.Run, n int, name string) (*prd.PRD, error) {
+	data, err := run.ReadIterationFile(n, name)
+	if err != nil {
+		return nil, err
+	}
+	return prd.Parse(data)
+}
+
+func parseIteration(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid iteration number: %s", s)
+	}
+	return n, nil
+}
+
+func runOutcome(r *history.Run) string {
+	switch {
+	case r.EndedAt == nil:
+		return color.CyanString("running")
+	case r.Success:
+		return color.GreenString(r.Reason)
+	case r.Reason == "":
+		return "unknown"
+	default:
+		return color.YellowString(r.Reason)
+	}
+}
+
+func statusColor(status string) string {
+	switch strings.TrimSpace(status) {
+	case "success":
+		return color.GreenString(status)
+	case "agent_error", "timeout":
+		return color.RedString(status)
+	default:
+		return color.YellowString(status)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/fatih/color"
 	"github.com/kylemclaren/ralph/internal/config"
@@ -19,7 +20,8 @@ var initCmd = &cobra.Command{
   - ralph.yaml (configuration)
   - .ralph/prd.json (product requirements document)
   - .ralph/progress.txt (progress log)
-  - .ralph/prompt.md (agent prompt template)`,
+  - .ralph/prompt.md (agent prompt template)
+  - .ralph/.gitignore (keeps run history out of git)`,
 	RunE: runInit,
 }
 
@@ -71,12 +73,12 @@ func runInit(cmd *cobra.Command, args []string) error {
 			p.AddStory(prd.UserStory{
 				Title:       "Example user story",
 				Description: "Replace this with your actual user story",
-				AcceptanceCriteria: []string{
+				AcceptanceCriteria: prd.TextCriteria(
 					"Define clear acceptance criteria",
 					"Include testable conditions",
 					"typecheck passes",
 					"tests pass",
-				},
+				),
 				Priority: 1,
 				Passes:   false,
 			})
@@ -109,6 +111,17 @@ func runInit(cmd *cobra.Command, args []string) error {
 		skipped = append(skipped, cfg.Paths.Prompt)
 	}
 
+	// Keep run history and worktrees out of git
+	ignorePath := filepath.Join(filepath.Dir(cfg.Paths.PRD), ".gitignore")
+	if !fileExists(ignorePath) || initForce {
+		if err := os.WriteFile(ignorePath, []byte("runs/\nworktrees/\n"), 0644); err != nil {
+			return fmt.Errorf("failed to create %s: %w", ignorePath, err)
+		}
+		created = append(created, ignorePath)
+	} else {
+		skipped = append(skipped, ignorePath)
+	}
+
 	// Print results
 	if len(created) > 0 {
 		color.Green("✓ Created:")
@@ -155,6 +168,17 @@ agent:
   flags: []
   # Maximum time per iteration
   timeout: 30m
+  # Time an interrupted agent gets to exit before it is killed, together
+  # with the processes it started
+  gracePeriod: 10s
+  # Regex matched against the agent's final output to detect completion
+  # (default: <promise>COMPLETE</promise>\s*$, anchored to the end)
+  completionPattern: ""
+  # How the prompt is delivered: arg, stdin or file (default depends on type)
+  # promptMode: stdin
+  # Extra environment variables for the agent
+  # env:
+  #   - "MY_VAR=value"
 
 # Loop configuration
 loop:
@@ -162,32 +186,88 @@ loop:
   maxIterations: 25
   # Time to sleep between iterations
   sleepBetween: 2s
-  # Stop on first failure (default: continue)
+  # Stop on first failure (default: retry)
   stopOnFirstFailure: false
+  # Consecutive failed iterations (agent crash or timeout) to retry
+  maxRetries: 3
+  # Delay before the first retry, doubled on each consecutive failure
+  retryBackoff: 10s
+  # Upper bound for the retry delay
+  maxBackoff: 5m
+  # Iterations a story may take without passing before stallPolicy applies (0 = unlimited)
+  maxAttemptsPerStory: 0
+  # What to do with a stalled story: skip (this run), stop, block (mark in PRD)
+  stallPolicy: block
+  # Stop the run after spending this much in USD or tokens (0 = unlimited, claude-code only)
+  maxCostUSD: 0
+  maxTokens: 0
 
 # File paths (relative to project root)
 paths:
   prd: .ralph/prd.json
   progress: .ralph/progress.txt
   prompt: .ralph/prompt.md
+  # Partials ({{template "name" .}}) and per-story templates (promptTemplate)
+  prompts: .ralph/prompts
+  # Run history (per-iteration metadata and agent output)
+  runs: .ralph/runs
+  # Raw progress logs saved before compaction
+  archive: .ralph/archive
 
-# Lifecycle hooks
+# Progress log compaction (see 'ralph log compact')
+progress:
+  # Compact the log before an iteration once it is larger than this (0 = never)
+  maxBytes: 0
+  # Most recent entries kept verbatim
+  keepEntries: 3
+  # Have the configured agent write the summary instead of the built-in one
+  useAgent: false
+
+# Lifecycle hooks. Each hook is a shell command, or an object with run,
+# timeout, cwd, env and continueOnError.
 hooks:
   enabled: true
   # Commands to run before the loop starts
   onStart: []
-  # Commands to run before each iteration
+  # Commands to run before each iteration. A hook may print a JSON object as
+  # its last line: {"skip": true}, {"story": "US-007"} or {"extraPrompt": "..."}
   onIteration: []
+  # Commands to run after each iteration (RALPH_EXIT_CODE, RALPH_STATUS, ...).
+  # Printing {"markPassing": false, "reason": "..."} rejects completed stories
+  afterIteration: []
+  # Commands to run when a story starts passing
+  onStoryComplete: []
+  # Commands to run when an iteration fails its story (RALPH_FAILURE_REASON)
+  onStoryFailed: []
   # Commands to run when all stories complete
   onComplete: []
   # Commands to run on failure
   onFailure: []
+  # Commands to run when the loop stops on request or is interrupted
+  onStop: []
+
+# Verify stories the agent marks as passing against git
+verify:
+  enabled: false
+  # HEAD must move during the iteration
+  requireCommit: true
+  # A new commit message must mention the story ID
+  requireStoryId: true
+  # No uncommitted changes outside Ralph's own files
+  requireCleanTree: true
+  # Max time per acceptance check command (checks run even when verify is disabled)
+  checkTimeout: 10m
 
 # Notifications (optional)
 notifications:
   enabled: false
-  # Webhook URL for Slack/Discord notifications
+  # Webhook URL: Slack, Discord or any URL accepting a JSON POST
   webhook: ""
+  # Payload format: auto (by webhook URL), slack, discord or json
+  format: auto
+  # Events to send: start, storyComplete, failure, maxIterations, complete
+  # (default: all)
+  events: []
 `
 	return os.WriteFile(path, []byte(content), 0644)
 }
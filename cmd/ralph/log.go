@@ -1,14 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 
 	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/agent"
 	"github.com/kylemclaren/ralph/internal/config"
+	"github.com/kylemclaren/ralph/internal/loop"
 	"github.com/kylemclaren/ralph/internal/progress"
+	"github.com/kylemclaren/ralph/internal/prompt"
 	"github.com/spf13/cobra"
 )
 
@@ -22,16 +27,45 @@ Examples:
   ralph log --edit             # Edit the progress log
   ralph log --append "Note"    # Append a note
   ralph log --patterns         # Show codebase patterns section
-  ralph log --clear            # Clear the progress log`,
+  ralph log --story US-003     # Show the entries for one story
+  ralph log --json             # Print the parsed entries as JSON
+  ralph log --clear            # Clear the progress log
+  ralph log compact            # Fold old entries into a summary`,
 	RunE: runLog,
 }
 
+var logCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Fold old progress entries into a summary",
+	Long: `Fold all but the most recent progress entries into a summary section.
+
+The "## Codebase Patterns" and "## Key Files" sections are kept verbatim, and
+the raw log is archived under .ralph/archive/ first. By default each story is
+reduced to one line with its learnings; with --agent the configured agent
+writes the summary instead.
+
+Set progress.maxBytes in ralph.yaml to compact automatically before an
+iteration once the log grows past that size.
+
+Examples:
+  ralph log compact              # Keep the last 3 entries verbatim
+  ralph log compact --keep 0     # Fold every entry
+  ralph log compact --agent      # Have the agent write the summary`,
+	Args: cobra.NoArgs,
+	RunE: runLogCompact,
+}
+
 var (
 	logEdit     bool
 	logAppend   string
 	logPatterns bool
 	logClear    bool
 	logTail     int
+	logStory    string
+	logJSON     bool
+
+	logCompactKeep  int
+	logCompactAgent bool
 )
 
 func init() {
@@ -40,6 +74,11 @@ func init() {
 	logCmd.Flags().BoolVarP(&logPatterns, "patterns", "p", false, "Show codebase patterns section")
 	logCmd.Flags().BoolVar(&logClear, "clear", false, "Clear and reset the progress log")
 	logCmd.Flags().IntVarP(&logTail, "tail", "t", 0, "Show last N lines")
+	logCmd.Flags().StringVarP(&logStory, "story", "s", "", "Show only the entries for a story")
+	logCmd.Flags().BoolVar(&logJSON, "json", false, "Print the parsed entries as JSON")
+	logCompactCmd.Flags().IntVarP(&logCompactKeep, "keep", "k", -1, "Recent entries to keep verbatim (default progress.keepEntries)")
+	logCompactCmd.Flags().BoolVar(&logCompactAgent, "agent", false, "Have the configured agent write the summary")
+	logCmd.AddCommand(logCompactCmd)
 	rootCmd.AddCommand(logCmd)
 }
 
@@ -99,6 +138,36 @@ func runLog(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	// Parsed entries, optionally for one story
+	if logStory != "" || logJSON {
+		entries := prog.Entries()
+		if logStory != "" {
+			entries = progress.FilterEntries(entries, logStory)
+		}
+
+		if logJSON {
+			if entries == nil {
+				entries = []progress.Entry{}
+			}
+			data, err := json.MarshalIndent(entries, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal entries: %w", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		if len(entries) == 0 {
+			color.Yellow("No progress entries for %s", strings.ToUpper(logStory))
+			return nil
+		}
+		for _, e := range entries {
+			fmt.Println(strings.TrimSpace(e.Text))
+			fmt.Println()
+		}
+		return nil
+	}
+
 	// Patterns mode
 	if logPatterns {
 		patterns := prog.GetCodebasePatterns()
@@ -126,3 +195,47 @@ func runLog(cmd *cobra.Command, args []string) error {
 	fmt.Println(content)
 	return nil
 }
+
+func runLogCompact(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if !progress.Exists(cfg.Paths.Progress) {
+		color.Yellow("Progress log not found at %s", cfg.Paths.Progress)
+		return nil
+	}
+
+	keep := cfg.Progress.KeepEntries
+	if cmd.Flags().Changed("keep") {
+		keep = logCompactKeep
+	}
+
+	var ag *agent.Agent
+	if logCompactAgent || cfg.Progress.UseAgent {
+		ag, err = loop.NewAgent(cfg)
+		if err != nil {
+			return err
+		}
+		ag.Output = io.Discard
+		fmt.Printf("Summarizing with %s...\n", ag.Name())
+	}
+
+	result, err := loop.CompactProgress(cmd.Context(), cfg, keep, ag)
+	if err != nil {
+		return fmt.Errorf("failed to compact progress log: %w", err)
+	}
+	if result.Folded == 0 {
+		fmt.Printf("Nothing to compact: %s has no more than %d entries\n", cfg.Paths.Progress, keep)
+		return nil
+	}
+
+	color.Green("✓ Folded %d entries into the summary (%s → %s)", result.Folded,
+		prompt.FormatSize(result.BytesBefore), prompt.FormatSize(result.BytesAfter))
+	fmt.Printf("  Raw log archived to %s\n", result.Archive)
+	if result.Usage != nil {
+		fmt.Printf("  Spend: %s\n", result.Usage)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kylemclaren/ralph/internal/history"
+	"github.com/kylemclaren/ralph/internal/pidfile"
+	"github.com/spf13/cobra"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [run-id]",
+	Short: "Show the log of a background run",
+	Long: `Show the console log of a run started with 'ralph run --detach'.
+
+Without a run ID, shows the log of the running loop, or else of the latest
+run. Use "latest" as the run ID to refer to the most recent run.
+
+With --follow, keeps printing new output until the run ends. Ctrl+C stops
+following; the run keeps going.
+
+Examples:
+  ralph logs                        # Last 50 lines of the current run
+  ralph logs -f                     # Follow the log until the run ends
+  ralph logs -n 0 20260101-120000   # The whole log of a run`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLogs,
+}
+
+var (
+	logsFollow bool
+	logsLines  int
+)
+
+// followInterval is how often a followed log is checked for new output
+const followInterval = 200 * time.Millisecond
+
+func init() {
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Keep printing new output until the run ends")
+	logsCmd.Flags().IntVarP(&logsLines, "lines", "n", 50, "Number of lines to show first (0 for the whole log)")
+	rootCmd.AddCommand(logsCmd)
+}
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	runID, path, err := findLog(args)
+	if err != nil {
+		return err
+	}
+
+	offset, err := printTail(path, logsLines)
+	if err != nil {
+		return err
+	}
+	if !logsFollow {
+		return nil
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	return followLog(ctx, path, offset, func() bool { return runActive(runID) })
+}
+
+// findLog returns the run ID and log path of the run named in args, or of the
+// running loop, or of the latest run
+func findLog(args []string) (string, string, error) {
+	if len(args) == 0 {
+		if info, err := pidfile.New("").ReadInfo(); err == nil && info.LogPath != "" && runActive(info.RunID) {
+			return info.RunID, info.LogPath, nil
+		}
+	}
+
+	id := history.LatestRunAlias
+	if len(args) > 0 {
+		id = args[0]
+	}
+	run, err := historyStore().Get(id)
+	if err != nil {
+		return "", "", err
+	}
+
+	path := run.LogPath()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", "", fmt.Errorf("run %s has no log: only runs started with --detach write one. Run 'ralph history show %s' for its iterations", run.ID, run.ID)
+	}
+	return run.ID, path, nil
+}
+
+// runActive reports whether the loop recorded in the PID file is running the
+// given run
+func runActive(runID string) bool {
+	pf := pidfile.New("")
+	info, err := pf.ReadInfo()
+	if err != nil || info.RunID != runID {
+		return false
+	}
+	running, _ := pf.IsRunning()
+	return running
+}
+
+// printTail prints the last n lines of the log at path (all of it if n <= 0)
+// and returns the offset it read up to
+func printTail(path string, n int) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read log: %w", err)
+	}
+	os.Stdout.Write(lastLines(data, n))
+	return int64(len(data)), nil
+}
+
+// printLogTail prints the end of a log, ignoring errors
+func printLogTail(path string, n int) {
+	_, _ = printTail(path, n)
+}
+
+// lastLines returns the last n lines of data, or all of it if n <= 0
+func lastLines(data []byte, n int) []byte {
+	if n <= 0 {
+		return data
+	}
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+	for i := 0; i < n; i++ {
+		j := bytes.LastIndexByte(data[:end], '\n')
+		if j < 0 {
+			return data
+		}
+		end = j
+	}
+	return data[end+1:]
+}
+
+// followLog prints what is appended to the log at path from offset on, moving
+// on to the new file when the log rotates, until ctx is done or active reports
+// that the run ended
+func followLog(ctx context.Context, path string, offset int64, active func() bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open log: %w", err)
+	}
+	defer func() { f.Close() }()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read log: %w", err)
+	}
+
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	ended := false
+	for {
+		n, err := io.Copy(os.Stdout, f)
+		if err != nil {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+
+		// The file at path is a new one once the log rotated: finish the old
+		// one, which is no longer written to, first
+		if rotated, err := logRotated(f, path); err != nil {
+			return err
+		} else if rotated {
+			if _, err := io.Copy(os.Stdout, f); err != nil {
+				return fmt.Errorf("failed to read log: %w", err)
+			}
+			f.Close()
+			if f, err = os.Open(path); err != nil {
+				return fmt.Errorf("failed to open log: %w", err)
+			}
+			continue
+		}
+
+		// Output can still be on its way when the run ends; stop once
+		// nothing more arrives
+		if ended && n == 0 {
+			return nil
+		}
+		ended = !active()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func logRotated(f *os.File, path string) (bool, error) {
+	current, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Between renames
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read log: %w", err)
+	}
+	open, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to read log: %w", err)
+	}
+	return !os.SameFile(open, current), nil
+}
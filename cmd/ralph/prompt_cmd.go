@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/kylemclaren/ralph/internal/config"
@@ -22,20 +23,62 @@ Examples:
   ralph prompt              # View the prompt template
   ralph prompt --edit       # Edit the prompt template
   ralph prompt --render     # Render the prompt with current PRD/progress
-  ralph prompt --reset      # Reset to default prompt`,
+  ralph prompt --render --story US-003  # Preview the prompt for a specific story
+  ralph prompt --reset      # Reset to default prompt
+  ralph prompt list         # List the prompt templates and the stories using them
+  ralph prompt validate     # Parse and render every template
+  ralph prompt lint         # Check the templates against sample data`,
 	RunE: runPrompt,
 }
 
+var promptListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the prompt templates and the stories using them",
+	Args:  cobra.NoArgs,
+	RunE:  runPromptList,
+}
+
+var promptValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Parse every prompt template and render it for each story",
+	Long: `Parse the main prompt template and every template in the prompts directory,
+then render the prompt of each story with the current PRD and progress log.
+
+Fails if a template does not parse, uses a field or partial that does not
+exist, or a story names a promptTemplate that is missing.`,
+	Args: cobra.NoArgs,
+	RunE: runPromptValidate,
+}
+
+var promptLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check the prompt templates for mistakes before running",
+	Long: `Render the main prompt template and each story's promptTemplate against
+sample data that sets every field, in strict mode, and report problems as
+file:line:col diagnostics. 'ralph run' performs the same check before it starts.
+
+Also warns when a template never mentions the completion marker
+` + prompt.CompletionMarker + `, which the agent must print once every story
+passes. The check is skipped when agent.completionPattern is customized.`,
+	Args: cobra.NoArgs,
+	RunE: runPromptLint,
+}
+
 var (
 	promptEdit   bool
 	promptRender bool
 	promptReset  bool
+	promptStory  string
 )
 
 func init() {
 	promptCmd.Flags().BoolVarP(&promptEdit, "edit", "e", false, "Edit the prompt template")
 	promptCmd.Flags().BoolVarP(&promptRender, "render", "r", false, "Render the prompt with current data")
 	promptCmd.Flags().BoolVar(&promptReset, "reset", false, "Reset to default prompt template")
+	promptCmd.Flags().StringVarP(&promptStory, "story", "s", "", "Story to render the prompt for (default: next story)")
+	promptCmd.AddCommand(promptListCmd)
+	promptCmd.AddCommand(promptValidateCmd)
+	promptCmd.AddCommand(promptLintCmd)
 	rootCmd.AddCommand(promptCmd)
 }
 
@@ -80,7 +123,7 @@ func runPrompt(cmd *cobra.Command, args []string) error {
 	}
 
 	// Render mode
-	if promptRender {
+	if promptRender || promptStory != "" {
 		return renderPrompt(cfg)
 	}
 
@@ -95,36 +138,231 @@ func runPrompt(cmd *cobra.Command, args []string) error {
 }
 
 func renderPrompt(cfg *config.Config) error {
-	// Load prompt template
-	templateContent, err := prompt.Load(cfg.Paths.Prompt)
+	set, err := prompt.LoadSet(cfg.Paths.Prompt, cfg.Paths.Prompts)
 	if err != nil {
 		return fmt.Errorf("failed to load prompt: %w", err)
 	}
 
-	// Load PRD
-	p, err := prd.Load(cfg.Paths.PRD)
+	p, prog, err := loadPromptInputs(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to load PRD: %w", err)
+		return err
 	}
 
-	// Load progress
-	prog, err := progress.Load(cfg.Paths.Progress)
-	if err != nil {
-		return fmt.Errorf("failed to load progress: %w", err)
+	// Preview for a specific story instead of the next one
+	story := p.NextStory()
+	if promptStory != "" {
+		if story = p.GetStory(promptStory); story == nil {
+			return fmt.Errorf("story %s not found", promptStory)
+		}
 	}
 
-	// Build template data
-	data, err := prompt.BuildTemplateData(p, prog)
+	data, err := previewData(cfg, p, prog, story)
 	if err != nil {
-		return fmt.Errorf("failed to build template data: %w", err)
+		return err
 	}
 
 	// Render
-	rendered, err := prompt.Render(templateContent, data)
+	name, err := set.TemplateFor(story)
 	if err != nil {
-		return fmt.Errorf("failed to render prompt: %w", err)
+		return err
+	}
+	rendered, err := set.Render(name, data)
+	if err != nil {
+		return err
 	}
 
 	fmt.Println(rendered)
 	return nil
 }
+
+func runPromptList(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+
+	set, err := prompt.LoadSet(cfg.Paths.Prompt, cfg.Paths.Prompts)
+	if err != nil {
+		return fmt.Errorf("failed to load prompt: %w", err)
+	}
+
+	// Which stories render each template
+	users := make(map[string][]string)
+	var missing []string
+	if p, err := prd.Load(cfg.Paths.PRD); err == nil {
+		for i := range p.UserStories {
+			story := &p.UserStories[i]
+			name, err := set.TemplateFor(story)
+			if err != nil {
+				missing = append(missing, err.Error())
+				continue
+			}
+			users[name] = append(users[name], story.ID)
+		}
+	}
+
+	fmt.Println()
+	color.Cyan("Prompt templates")
+	fmt.Println()
+	printTemplate := func(label, name string) {
+		stories := color.HiBlackString("partial")
+		if ids := users[name]; len(ids) > 0 {
+			stories = strings.Join(ids, ", ")
+		}
+		fmt.Printf("  %-16s %-36s %s\n", label, set.Path(name), stories)
+	}
+	printTemplate("(main)", "")
+	for _, name := range set.Names() {
+		printTemplate(name, name)
+	}
+	if len(set.Templates) == 0 {
+		fmt.Println()
+		fmt.Printf("  Add partials and per-story templates as %s/<name>%s\n", cfg.Paths.Prompts, prompt.TemplateExt)
+	}
+	for _, m := range missing {
+		fmt.Printf("\n  %s %s", color.RedString("✗"), m)
+	}
+	fmt.Println()
+
+	return nil
+}
+
+func runPromptValidate(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+
+	set, err := prompt.LoadSet(cfg.Paths.Prompt, cfg.Paths.Prompts)
+	if err != nil {
+		return fmt.Errorf("failed to load prompt: %w", err)
+	}
+	p, prog, err := loadPromptInputs(cfg)
+	if err != nil {
+		return err
+	}
+
+	problems := 0
+	report := func(label string, err error) {
+		if err != nil {
+			problems++
+			fmt.Printf("%s %s: %v\n", color.RedString("✗"), label, err)
+			return
+		}
+		fmt.Printf("%s %s\n", color.GreenString("✓"), label)
+	}
+
+	// Every template must parse with the partials defined
+	names := append([]string{""}, set.Names()...)
+	for _, name := range names {
+		_, err := set.Parse(name)
+		report(set.Path(name), err)
+	}
+
+	// Render each story's prompt, which catches missing fields and partials
+	stories := make([]*prd.UserStory, len(p.UserStories))
+	for i := range p.UserStories {
+		stories[i] = &p.UserStories[i]
+	}
+	if len(stories) == 0 {
+		stories = append(stories, nil)
+	}
+	for _, story := range stories {
+		label := "prompt with no stories"
+		if story != nil {
+			label = "prompt for " + story.ID
+		}
+
+		name, err := set.TemplateFor(story)
+		if err == nil {
+			var data prompt.TemplateData
+			if data, err = previewData(cfg, p, prog, story); err == nil {
+				_, err = set.Render(name, data)
+			}
+		}
+		if err == nil && name != "" {
+			label += " (" + name + ")"
+		}
+		report(label, err)
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d prompt template problem(s) found", problems)
+	}
+	return nil
+}
+
+func runPromptLint(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+
+	set, err := prompt.LoadSet(cfg.Paths.Prompt, cfg.Paths.Prompts)
+	if err != nil {
+		return fmt.Errorf("failed to load prompt: %w", err)
+	}
+
+	// Without a PRD only the main template is checked
+	var stories []prd.UserStory
+	if p, err := prd.Load(cfg.Paths.PRD); err == nil {
+		stories = p.UserStories
+	}
+
+	// A custom completion pattern has no fixed marker to look for
+	marker := prompt.CompletionMarker
+	if cfg.Agent.CompletionPattern != "" {
+		marker = ""
+	}
+
+	problems := 0
+	for _, d := range set.Lint(stories, marker) {
+		if d.Warning {
+			fmt.Printf("%s %s\n", color.YellowString("⚠"), d)
+			continue
+		}
+		problems++
+		fmt.Printf("%s %s\n", color.RedString("✗"), d)
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d prompt template problem(s) found", problems)
+	}
+	color.Green("✓ Prompt templates look good")
+	return nil
+}
+
+// loadPromptInputs loads the PRD and progress log a prompt is rendered from
+func loadPromptInputs(cfg *config.Config) (*prd.PRD, *progress.Progress, error) {
+	p, err := prd.Load(cfg.Paths.PRD)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load PRD: %w", err)
+	}
+
+	prog, err := progress.Load(cfg.Paths.Progress)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load progress: %w", err)
+	}
+
+	return p, prog, nil
+}
+
+// previewData builds the template data of the first iteration working on
+// story, as 'ralph run' would
+func previewData(cfg *config.Config, p *prd.PRD, prog *progress.Progress, story *prd.UserStory) (prompt.TemplateData, error) {
+	data, err := prompt.BuildTemplateData(p, prog)
+	if err != nil {
+		return data, fmt.Errorf("failed to build template data: %w", err)
+	}
+	data.Iteration = 1
+	data.MaxIterations = cfg.Loop.MaxIterations
+	data.NextStory = story
+	data.StoryEntries = prompt.StoryEntries(data.Entries, story)
+
+	if story != nil {
+		if checks, err := prd.LoadCheckFailures(cfg.Paths.PRD); err == nil {
+			data.FailedChecks = checks.Get(story.ID)
+		}
+	}
+	return data, nil
+}
@@ -14,6 +14,8 @@ var resetCmd = &cobra.Command{
 	Short: "Mark a story as pending (not passing)",
 	Long: `Mark a user story as pending/not passing.
 
+Resetting a story also clears its blocked flag so Ralph will pick it up again.
+
 Examples:
   ralph reset US-001
   ralph reset us-001    # Case insensitive
@@ -46,8 +48,9 @@ func runReset(cmd *cobra.Command, args []string) error {
 		// Reset all stories
 		count := 0
 		for i := range p.UserStories {
-			if p.UserStories[i].Passes {
+			if p.UserStories[i].Passes || p.UserStories[i].Blocked {
 				p.UserStories[i].Passes = false
+				p.UserStories[i].Blocked = false
 				count++
 			}
 		}
@@ -57,7 +60,7 @@ func runReset(cmd *cobra.Command, args []string) error {
 		}
 
 		if count == 0 {
-			color.Yellow("No completed stories to reset")
+			color.Yellow("No completed or blocked stories to reset")
 		} else {
 			color.Green("✓ Reset %d stories to pending", count)
 		}
@@ -77,7 +80,7 @@ func runReset(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("story %s not found", storyID)
 	}
 
-	if !story.Passes {
+	if !story.Passes && !story.Blocked {
 		color.Yellow("Story %s is already pending", story.ID)
 		return nil
 	}
@@ -3,14 +3,22 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/kylemclaren/ralph/internal/config"
+	"github.com/kylemclaren/ralph/internal/control"
+	"github.com/kylemclaren/ralph/internal/history"
 	"github.com/kylemclaren/ralph/internal/loop"
+	"github.com/kylemclaren/ralph/internal/monitor"
+	"github.com/kylemclaren/ralph/internal/notify"
 	"github.com/kylemclaren/ralph/internal/pidfile"
+	"github.com/kylemclaren/ralph/internal/prd"
 	"github.com/spf13/cobra"
 )
 
@@ -20,15 +28,19 @@ var runCmd = &cobra.Command{
 	Long: `Start the Ralph autonomous coding loop.
 
 Ralph will:
-1. Read the PRD and find the highest priority pending story
-2. Execute your configured AI agent with the prompt
-3. Check if all stories are complete
-4. Repeat until done or max iterations reached
+1. Check out the PRD's branchName, creating it if needed
+2. Read the PRD and find the highest priority pending story
+3. Execute your configured AI agent with the prompt
+4. Check if all stories are complete
+5. Repeat until done or max iterations reached
 
 Examples:
   ralph run                    # Run with default settings
   ralph run --max-iterations 10  # Limit to 10 iterations
   ralph run --once             # Run a single iteration (human-in-the-loop)
+  ralph run --parallel 3       # Work on up to 3 ready stories at once in git worktrees
+  ralph run --serve :7777      # Serve a status API and live dashboard on localhost:7777
+  ralph run --detach           # Keep running in the background, logging to .ralph/runs/
   ralph run --dry-run          # Show what would be executed`,
 	RunE: runLoop,
 }
@@ -38,13 +50,25 @@ var (
 	runOnce          bool
 	runDryRun        bool
 	runVerbose       bool
+	runParallel      int
+	runAllowDirty    bool
+	runServe         string
+	runDetach        bool
 )
 
+// notifyFlushTimeout bounds how long ralph waits on exit for notifications
+// still being sent
+const notifyFlushTimeout = 15 * time.Second
+
 func init() {
 	runCmd.Flags().IntVarP(&runMaxIterations, "max-iterations", "n", 0, "Maximum iterations (overrides config)")
 	runCmd.Flags().BoolVar(&runOnce, "once", false, "Run a single iteration (human-in-the-loop mode)")
 	runCmd.Flags().BoolVar(&runDryRun, "dry-run", false, "Show what would be executed without running")
 	runCmd.Flags().BoolVarP(&runVerbose, "verbose", "v", false, "Verbose output")
+	runCmd.Flags().BoolVar(&runAllowDirty, "allow-dirty", false, "Start even if tracked files have uncommitted changes")
+	runCmd.Flags().IntVar(&runParallel, "parallel", 1, "Number of stories to run concurrently, each in its own git worktree")
+	runCmd.Flags().StringVar(&runServe, "serve", "", "Serve a status API and live dashboard on this address (e.g. :7777)")
+	runCmd.Flags().BoolVar(&runDetach, "detach", false, "Run in the background, writing output to a log in the run's directory")
 	rootCmd.AddCommand(runCmd)
 }
 
@@ -56,6 +80,25 @@ func runLoop(cmd *cobra.Command, args []string) error {
 		cfg = config.DefaultConfig()
 	}
 
+	// Start again in the background and return once that run is under way
+	if runDetach {
+		if runDryRun {
+			return fmt.Errorf("--detach cannot be combined with --dry-run")
+		}
+		return detachRun(cfg)
+	}
+
+	// This is the background process started by --detach
+	if runID := os.Getenv(envDetachedRun); runID != "" {
+		return runDetached(cmd, cfg, runID)
+	}
+
+	return startLoop(cfg, "", "")
+}
+
+// startLoop runs the loop in this process. A detached run passes the run ID
+// chosen by the process that started it and the log its output goes to.
+func startLoop(cfg *config.Config, runID, logPath string) error {
 	// Write PID file
 	pf := pidfile.New("")
 	if err := pf.Write(); err != nil {
@@ -72,6 +115,13 @@ func runLoop(cmd *cobra.Command, args []string) error {
 		cfg.Loop.MaxIterations = 1
 	}
 
+	if runParallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	if runParallel > 1 && runOnce {
+		return fmt.Errorf("--parallel cannot be combined with --once")
+	}
+
 	// Check required files exist
 	if _, err := os.Stat(cfg.Paths.PRD); os.IsNotExist(err) {
 		return fmt.Errorf("PRD not found at %s. Run 'ralph init' first", cfg.Paths.PRD)
@@ -91,22 +141,90 @@ func runLoop(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Catch template mistakes before any hook or agent runs
+	if err := validatePrompt(l); err != nil {
+		return err
+	}
+
 	// Dry run mode
 	if runDryRun {
 		return dryRun(cfg, l)
 	}
 
+	// Work on the PRD's branch
+	if err := l.PrepareBranch(runAllowDirty); err != nil {
+		return err
+	}
+
+	// Record this run in the run history
+	mode := "loop"
+	if runOnce {
+		mode = "once"
+	} else if runParallel > 1 {
+		mode = "parallel"
+	}
+	run := &history.Run{
+		ID:            runID,
+		Mode:          mode,
+		Agent:         cfg.Agent.Type,
+		Branch:        l.PRD.BranchName,
+		PRDPath:       cfg.Paths.PRD,
+		MaxIterations: cfg.Loop.MaxIterations,
+	}
+	if err := history.NewStore(cfg.Paths.Runs).Start(run); err != nil {
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+	l.History = run
+	if err := pf.Update(func(info *pidfile.Info) {
+		info.RunID = run.ID
+		info.LogPath = logPath
+	}); err != nil {
+		color.Yellow("Warning: failed to update PID file: %v", err)
+	}
+
+	// Serve the live state of the run
+	dashboard := ""
+	if runServe != "" {
+		l.Monitor = monitor.New(run, cfg.Paths.PRD)
+		srv, err := monitor.Serve(l.Monitor, runServe)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = srv.Close() }()
+		if err := pf.Update(func(info *pidfile.Info) { info.Addr = srv.Addr }); err != nil {
+			color.Yellow("Warning: failed to update PID file: %v", err)
+		}
+		dashboard = "http://" + srv.Addr + "/"
+	}
+
+	// Take pause, resume and skip requests from other ralph commands
+	ctl, err := control.Listen(control.Path(""), controlHandler(l, pf))
+	if err != nil {
+		color.Yellow("Warning: %v; pause, resume and skip are unavailable", err)
+	} else {
+		defer func() { _ = ctl.Close() }()
+	}
+
 	// Print startup info
-	printStartup(cfg, l)
+	printStartup(cfg, l, dashboard)
 
 	// Set up context with signal handling
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Handle interrupt
-	sigChan := make(chan os.Signal, 1)
+	// The first interrupt lets the iterations in progress finish; a second
+	// one interrupts the agent
+	sigChan := make(chan os.Signal, 2)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
+		<-sigChan
+		l.RequestStop()
+		if err := pf.Update(func(info *pidfile.Info) { info.Stopping = true }); err != nil {
+			color.Yellow("Warning: failed to update PID file: %v", err)
+		}
+		fmt.Println()
+		color.Yellow("Stopping after the current iteration. Press Ctrl+C again or run 'ralph stop --now' to stop now.")
+
 		<-sigChan
 		fmt.Println("\n\nInterrupted. Cleaning up...")
 		cancel()
@@ -119,23 +237,39 @@ func runLoop(cmd *cobra.Command, args []string) error {
 		fmt.Println()
 		iterResult := l.RunOnce(ctx)
 		result = &loop.Result{
-			Success:    iterResult.Complete || iterResult.Error == nil,
-			Iterations: 1,
-			Error:      iterResult.Error,
+			Success:         iterResult.Complete || iterResult.Error == nil,
+			Iterations:      1,
+			StoriesComplete: l.StoriesComplete,
+			Error:           iterResult.Error,
 		}
 		if iterResult.Complete {
 			result.Reason = "complete"
 		} else if iterResult.Error != nil {
 			result.Reason = "error"
+		} else if iterResult.Failed() {
+			result.Success = false
+			result.Reason = "failure"
+			result.Error = fmt.Errorf("iteration failed (%s): %s", iterResult.Status, iterResult.Message)
 		} else {
 			result.Reason = "iteration_complete"
 		}
+	} else if runParallel > 1 {
+		result = l.RunParallel(ctx, runParallel)
 	} else {
 		result = l.Run(ctx)
 	}
 
+	l.Monitor.Finish(result.Reason)
+	l.FlushNotifications(notifyFlushTimeout)
+	if err := run.Finish(result.Success, result.Reason, result.Iterations, result.StoriesComplete, result.Error); err != nil {
+		color.Yellow("Warning: failed to record run: %v", err)
+	}
+
 	// Print result
 	fmt.Println()
+	if l.Usage.Tokens() > 0 {
+		fmt.Printf("Spend: %s\n", &l.Usage)
+	}
 	if result.Error != nil {
 		color.Red("Error: %v", result.Error)
 		return result.Error
@@ -149,12 +283,18 @@ func runLoop(cmd *cobra.Command, args []string) error {
 		}
 	} else if result.Reason == "max_iterations" {
 		color.Yellow("Max iterations reached. Run 'ralph run' to continue.")
+	} else if result.Reason == "stopped" {
+		color.Yellow("Stopped. Run 'ralph run' to continue.")
+	} else if result.Reason == "budget" {
+		color.Yellow("Budget reached after spending %s. Raise loop.maxCostUSD or loop.maxTokens to continue.", &l.Usage)
+	} else if result.Reason == "stalled" || result.Reason == "blocked" {
+		color.Yellow("Run 'ralph status' to review stalled stories, and 'ralph reset <id>' to unblock one.")
 	}
 
 	return nil
 }
 
-func printStartup(cfg *config.Config, l *loop.Loop) {
+func printStartup(cfg *config.Config, l *loop.Loop, dashboard string) {
 	total, completed, pending := l.PRD.Stats()
 
 	fmt.Println()
@@ -164,10 +304,23 @@ func printStartup(cfg *config.Config, l *loop.Loop) {
 	fmt.Printf("  Branch:     %s\n", l.PRD.BranchName)
 	fmt.Printf("  Stories:    %d total, %d pending, %d complete\n", total, pending, completed)
 	fmt.Printf("  Max Iter:   %d\n", cfg.Loop.MaxIterations)
+	if runParallel > 1 {
+		fmt.Printf("  Parallel:   %d workers\n", runParallel)
+	}
 
 	if l.Hooks.HasHooks() {
 		fmt.Printf("  Hooks:      enabled\n")
 	}
+	if l.Notifier != nil {
+		fmt.Printf("  Notify:     %s\n", describeNotifier(l.Notifier))
+	}
+
+	if l.History != nil {
+		fmt.Printf("  Run:        %s\n", l.History.ID)
+	}
+	if dashboard != "" {
+		fmt.Printf("  Dashboard:  %s\n", dashboard)
+	}
 
 	fmt.Println()
 
@@ -178,6 +331,105 @@ func printStartup(cfg *config.Config, l *loop.Loop) {
 	fmt.Println()
 }
 
+// controlHandler carries out requests from 'ralph pause', 'ralph resume' and
+// 'ralph skip', recording a pause in the PID file for 'ralph status'
+func controlHandler(l *loop.Loop, pf *pidfile.PIDFile) control.Handler {
+	setPaused := func(paused bool) {
+		if err := pf.Update(func(info *pidfile.Info) { info.Paused = paused }); err != nil {
+			color.Yellow("Warning: failed to update PID file: %v", err)
+		}
+	}
+
+	return func(req control.Request) (string, error) {
+		switch req.Command {
+		case control.CommandPause:
+			if !l.Pause() {
+				return "Ralph is already paused", nil
+			}
+			setPaused(true)
+			return "Ralph will pause before the next iteration", nil
+		case control.CommandResume:
+			if !l.Resume() {
+				return "Ralph is not paused", nil
+			}
+			setPaused(false)
+			return "Ralph resumed", nil
+		case control.CommandSkip:
+			id, err := l.Skip(req.Story)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Skipping %s; Ralph moves on to the next story", id), nil
+		}
+		return "", fmt.Errorf("unknown command %q", req.Command)
+	}
+}
+
+// printHooks lists the hooks of one type with the options that differ from the
+// defaults
+func printHooks(name string, list []config.HookConfig) {
+	for _, h := range list {
+		var opts []string
+		if h.Timeout > 0 {
+			opts = append(opts, "timeout "+h.Timeout.String())
+		}
+		if h.Cwd != "" {
+			opts = append(opts, "in "+h.Cwd)
+		}
+		if h.ContinueOnError {
+			opts = append(opts, "continue on error")
+		}
+		line := h.Run
+		if len(opts) > 0 {
+			line += color.HiBlackString(" (%s)", strings.Join(opts, ", "))
+		}
+		fmt.Printf("  %-16s %s\n", name+":", line)
+	}
+}
+
+// describeNotifier summarizes the webhook notifications, naming only the
+// webhook's host since its URL usually holds a secret
+func describeNotifier(n *notify.Notifier) string {
+	format := n.Format
+	if format == notify.FormatAuto {
+		format = notify.DetectFormat(n.URL)
+	}
+	host := n.URL
+	if u, err := url.Parse(n.URL); err == nil {
+		host = u.Host
+	}
+
+	events := "all events"
+	if len(n.Events) > 0 {
+		names := make([]string, len(n.Events))
+		for i, e := range n.Events {
+			names[i] = string(e)
+		}
+		events = strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s webhook at %s (%s)", format, host, events)
+}
+
+// validatePrompt checks the templates the pending stories render against
+// sample data and prints a diagnostic for each problem
+func validatePrompt(l *loop.Loop) error {
+	var stories []prd.UserStory
+	for _, s := range l.PRD.UserStories {
+		if !s.Passes {
+			stories = append(stories, s)
+		}
+	}
+
+	diags := l.Prompt.Validate(stories)
+	if len(diags) == 0 {
+		return nil
+	}
+	for _, d := range diags {
+		fmt.Printf("%s %s\n", color.RedString("✗"), d)
+	}
+	return fmt.Errorf("prompt template has %d problem(s); run 'ralph prompt lint' to check it", len(diags))
+}
+
 func dryRun(cfg *config.Config, l *loop.Loop) error {
 	total, completed, pending := l.PRD.Stats()
 
@@ -187,14 +439,34 @@ func dryRun(cfg *config.Config, l *loop.Loop) error {
 
 	fmt.Printf("Agent:\n")
 	fmt.Printf("  Type:    %s\n", cfg.Agent.Type)
-	cmd, args, _ := cfg.GetAgentCommand()
-	fmt.Printf("  Command: %s %v\n", cmd, args)
+	fmt.Printf("  Command: %s\n", l.Agent.CommandString())
+	fmt.Printf("  Prompt:  via %s\n", l.Agent.Driver.PromptMode())
 	fmt.Printf("  Timeout: %s\n", cfg.Agent.Timeout)
 	fmt.Println()
 
 	fmt.Printf("Loop:\n")
 	fmt.Printf("  Max Iterations: %d\n", cfg.Loop.MaxIterations)
 	fmt.Printf("  Sleep Between:  %s\n", cfg.Loop.SleepBetween)
+	if cfg.Loop.StopOnFirstFailure {
+		fmt.Printf("  On Failure:     stop\n")
+	} else {
+		fmt.Printf("  On Failure:     retry %d times (backoff %s, max %s)\n",
+			cfg.Loop.MaxRetries, cfg.Loop.RetryBackoff, cfg.Loop.MaxBackoff)
+	}
+	if cfg.Loop.MaxAttemptsPerStory > 0 {
+		fmt.Printf("  On Stall:       %s after %d attempts per story\n",
+			cfg.Loop.StallPolicy, cfg.Loop.MaxAttemptsPerStory)
+	}
+	if cfg.Loop.MaxCostUSD > 0 {
+		fmt.Printf("  Max Cost:       $%.2f\n", cfg.Loop.MaxCostUSD)
+	}
+	if cfg.Loop.MaxTokens > 0 {
+		fmt.Printf("  Max Tokens:     %d\n", cfg.Loop.MaxTokens)
+	}
+	if cfg.Verify.Enabled {
+		fmt.Printf("  Verify:         commit=%t storyId=%t cleanTree=%t\n",
+			cfg.Verify.RequireCommit, cfg.Verify.RequireStoryID, cfg.Verify.RequireCleanTree)
+	}
 	fmt.Println()
 
 	fmt.Printf("Files:\n")
@@ -212,21 +484,18 @@ func dryRun(cfg *config.Config, l *loop.Loop) error {
 
 	if l.Hooks.HasHooks() {
 		fmt.Printf("Hooks:\n")
-		if len(cfg.Hooks.OnStart) > 0 {
-			fmt.Printf("  onStart:     %v\n", cfg.Hooks.OnStart)
-		}
-		if len(cfg.Hooks.OnIteration) > 0 {
-			fmt.Printf("  onIteration: %v\n", cfg.Hooks.OnIteration)
-		}
-		if len(cfg.Hooks.OnComplete) > 0 {
-			fmt.Printf("  onComplete:  %v\n", cfg.Hooks.OnComplete)
-		}
-		if len(cfg.Hooks.OnFailure) > 0 {
-			fmt.Printf("  onFailure:   %v\n", cfg.Hooks.OnFailure)
+		for _, event := range cfg.Hooks.Events() {
+			printHooks(event.Name, event.Hooks)
 		}
 		fmt.Println()
 	}
 
+	if l.Notifier != nil {
+		fmt.Printf("Notifications:\n")
+		fmt.Printf("  %s\n", describeNotifier(l.Notifier))
+		fmt.Println()
+	}
+
 	if next := l.PRD.NextStory(); next != nil {
 		fmt.Printf("Next Story:\n")
 		fmt.Printf("  %s\n", next.FormatForDisplay())
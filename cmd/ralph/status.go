@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/agent"
 	"github.com/kylemclaren/ralph/internal/config"
+	"github.com/kylemclaren/ralph/internal/history"
+	"github.com/kylemclaren/ralph/internal/monitor"
+	"github.com/kylemclaren/ralph/internal/pidfile"
 	"github.com/kylemclaren/ralph/internal/prd"
 	"github.com/spf13/cobra"
 )
@@ -14,8 +20,11 @@ import (
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show PRD status and progress",
-	Long:  `Display the current status of all user stories in the PRD.`,
-	RunE:  runStatus,
+	Long: `Display the current status of all user stories in the PRD.
+
+When a loop is running, its current iteration is shown too, with live details
+and recent agent output if it was started with --serve.`,
+	RunE: runStatus,
 }
 
 var (
@@ -70,6 +79,8 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	color.Cyan("═══════════════════════════════════════════════════════════════")
 	fmt.Println()
 
+	printLiveRun()
+
 	// Print stats
 	fmt.Printf("  Branch: %s\n", p.BranchName)
 	fmt.Printf("  Total:  %d stories\n", total)
@@ -86,6 +97,29 @@ func runStatus(cmd *cobra.Command, args []string) error {
 		fmt.Printf("  Pending: %d stories\n", pending)
 	}
 
+	if blocked := len(p.BlockedStories()); blocked > 0 {
+		color.Red("  Blocked: %d stories", blocked)
+	}
+
+	waiting := 0
+	for i := range p.UserStories {
+		s := &p.UserStories[i]
+		if !s.Passes && !s.Blocked && len(p.UnmetDependencies(s)) > 0 {
+			waiting++
+		}
+	}
+	if waiting > 0 {
+		color.Blue("  Waiting: %d stories (unmet dependencies)", waiting)
+	}
+
+	if spend, runs := prdSpend(cfg, p); spend != nil {
+		plural := "s"
+		if runs == 1 {
+			plural = ""
+		}
+		fmt.Printf("  Spend:  %s over %d run%s\n", spend, runs, plural)
+	}
+
 	// Progress bar
 	if total > 0 {
 		fmt.Println()
@@ -122,7 +156,7 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	fmt.Println("  " + strings.Repeat("─", 60))
 
 	for _, story := range stories {
-		printStory(story)
+		printStory(p, story)
 	}
 
 	// Next story hint
@@ -135,11 +169,81 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func printStory(s prd.UserStory) {
+// liveOutputLines is how much recent agent output status shows for a running
+// loop
+const liveOutputLines = 5
+
+// printLiveRun shows the loop running in this directory, if any, asking its
+// status API for the iteration in progress
+func printLiveRun() {
+	pf := pidfile.New("")
+	running, pid := pf.IsRunning()
+	if !running {
+		return
+	}
+	info, err := pf.ReadInfo()
+	if err != nil || info.Addr == "" {
+		color.Green("  Running: PID %d", pid)
+		if err == nil {
+			printRunState(info)
+		}
+		fmt.Printf("  %s\n\n", color.HiBlackString("Start the loop with --serve for live details"))
+		return
+	}
+
+	ctx := context.Background()
+	live, err := monitor.FetchStatus(ctx, info.Addr)
+	if err != nil {
+		color.Green("  Running: PID %d", pid)
+		color.Yellow("  Status API at %s unreachable: %v", info.Addr, err)
+		fmt.Println()
+		return
+	}
+
+	color.Green("  Running: PID %d, run %s (%s)", live.PID, live.RunID, live.Mode)
+	printRunState(info)
+	fmt.Printf("  Iteration: %d/%d\n", live.Iteration, live.MaxIterations)
+	for _, a := range live.Active {
+		fmt.Printf("  Working:   %s - %s %s\n", a.StoryID, a.StoryTitle,
+			color.HiBlackString("(%s)", time.Since(a.StartedAt).Round(time.Second)))
+	}
+	fmt.Printf("  Elapsed:   %s\n", time.Since(live.StartedAt).Round(time.Second))
+	if live.Usage.Tokens() > 0 {
+		fmt.Printf("  Spend:     %s\n", &live.Usage)
+	}
+	fmt.Printf("  Dashboard: http://%s/\n", info.Addr)
+
+	if lines, err := monitor.FetchLines(ctx, info.Addr, liveOutputLines); err == nil && len(lines) > 0 {
+		fmt.Println()
+		fmt.Println("  Recent output:")
+		for _, line := range lines {
+			fmt.Printf("    %s\n", color.HiBlackString("%s", line.Text))
+		}
+	}
+	fmt.Println()
+}
+
+// printRunState shows whether the running loop was paused or asked to stop
+func printRunState(info *pidfile.Info) {
+	if info.Paused {
+		color.Yellow("  Paused: run 'ralph resume' to continue")
+	}
+	if info.Stopping {
+		color.Yellow("  Stopping after the current iteration")
+	}
+}
+
+func printStory(p *prd.PRD, s prd.UserStory) {
+	unmet := p.UnmetDependencies(&s)
+
 	// Status icon
 	var status string
 	if s.Passes {
 		status = color.GreenString("✓")
+	} else if s.Blocked {
+		status = color.RedString("⊘")
+	} else if len(unmet) > 0 {
+		status = color.BlueString("◌")
 	} else {
 		status = color.YellowString("○")
 	}
@@ -150,10 +254,18 @@ func printStory(s prd.UserStory) {
 	// Print story line
 	fmt.Printf("  %s [%s] %s: %s\n", status, priority, s.ID, s.Title)
 
+	if !s.Passes && len(unmet) > 0 {
+		fmt.Printf("      %s\n", color.BlueString("waiting on: %s", strings.Join(unmet, ", ")))
+	}
+
+	if s.Blocked && s.Notes != "" {
+		fmt.Printf("      %s\n", color.RedString(s.Notes))
+	}
+
 	// Print acceptance criteria if pending
 	if !s.Passes && len(s.AcceptanceCriteria) > 0 {
 		for _, ac := range s.AcceptanceCriteria {
-			fmt.Printf("      • %s\n", ac)
+			fmt.Printf("      • %s\n", ac.Describe())
 		}
 	}
 }
@@ -177,3 +289,26 @@ func printProgressBar(completed, total int) {
 
 	fmt.Printf("  [%s] %d%%\n", coloredBar, percentage)
 }
+
+// prdSpend totals the usage recorded in the run history for this PRD and
+// branch. It returns nil if no run reported usage.
+func prdSpend(cfg *config.Config, p *prd.PRD) (*agent.Usage, int) {
+	runs, err := history.NewStore(cfg.Paths.Runs).List()
+	if err != nil {
+		return nil, 0
+	}
+
+	var total *agent.Usage
+	count := 0
+	for _, r := range runs {
+		if r.Usage == nil || r.Branch != p.BranchName || r.PRDPath != cfg.Paths.PRD {
+			continue
+		}
+		if total == nil {
+			total = &agent.Usage{}
+		}
+		total.Add(r.Usage)
+		count++
+	}
+	return total, count
+}
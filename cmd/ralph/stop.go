@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/config"
 	"github.com/kylemclaren/ralph/internal/pidfile"
 	"github.com/spf13/cobra"
 )
@@ -14,23 +15,34 @@ var stopCmd = &cobra.Command{
 	Short: "Stop a running Ralph loop",
 	Long: `Stop a running Ralph loop gracefully.
 
-Sends SIGTERM to the running Ralph process, allowing it to finish the
-current iteration cleanly before exiting.
+Sends SIGTERM to the running Ralph process, which lets the current iteration
+finish and then stops. Ctrl+C in the terminal running Ralph does the same.
 
-Use --force to send SIGKILL for immediate termination.
+Use --now to interrupt the agent right away: its process group gets SIGINT,
+and SIGKILL once agent.gracePeriod has passed, before Ralph exits. Sending a
+second SIGTERM or pressing Ctrl+C twice does the same.
+
+Use --force to send SIGKILL to Ralph itself for immediate termination.
 
 Examples:
-  ralph stop          # Graceful stop (SIGTERM)
+  ralph stop          # Stop after the current iteration (SIGTERM)
+  ralph stop --now    # Interrupt the agent and stop now
   ralph stop --force  # Force stop (SIGKILL)`,
 	RunE: stopLoop,
 }
 
 var (
 	stopForce bool
+	stopNow   bool
 )
 
+// stopAckTimeout bounds how long stop waits for Ralph to acknowledge a stop
+// request in the PID file
+const stopAckTimeout = 3 * time.Second
+
 func init() {
 	stopCmd.Flags().BoolVarP(&stopForce, "force", "f", false, "Force stop (SIGKILL)")
+	stopCmd.Flags().BoolVar(&stopNow, "now", false, "Interrupt the current iteration instead of letting it finish")
 	rootCmd.AddCommand(stopCmd)
 }
 
@@ -45,38 +57,92 @@ func stopLoop(cmd *cobra.Command, args []string) error {
 
 	fmt.Printf("Found Ralph process (PID %d)\n", pid)
 
-	var err error
 	if stopForce {
 		fmt.Println("Sending SIGKILL...")
-		err = pf.Kill()
-	} else {
-		fmt.Println("Sending SIGTERM for graceful shutdown...")
-		err = pf.Stop()
+		if err := pf.Kill(); err != nil {
+			return fmt.Errorf("failed to stop Ralph: %w", err)
+		}
+		if waitForExit(pf, 3*time.Second) {
+			return nil
+		}
+		color.Red("Failed to stop process")
+		return nil
 	}
 
-	if err != nil {
+	// The first SIGTERM asks Ralph to stop after the current iteration
+	if info, err := pf.ReadInfo(); err != nil || !info.Stopping {
+		fmt.Println("Sending SIGTERM to stop after the current iteration...")
+		if err := pf.Stop(); err != nil {
+			return fmt.Errorf("failed to stop Ralph: %w", err)
+		}
+		if !waitForStopping(pf) {
+			// Between iterations Ralph exits right away
+			if running, _ := pf.IsRunning(); !running {
+				color.Green("Ralph stopped successfully")
+				_ = pf.Remove()
+				return nil
+			}
+			color.Yellow("Ralph did not acknowledge the stop request; use --force to kill it.")
+			return nil
+		}
+		if !stopNow {
+			color.Green("Ralph will stop once the current iteration finishes.")
+			fmt.Println("  Run 'ralph stop --now' to interrupt it instead")
+			return nil
+		}
+	} else if !stopNow {
+		color.Yellow("Ralph is already stopping after the current iteration.")
+		fmt.Println("  Run 'ralph stop --now' to interrupt it instead")
+		return nil
+	}
+
+	// A second SIGTERM interrupts the agent
+	fmt.Println("Sending SIGTERM to interrupt the current iteration...")
+	if err := pf.Stop(); err != nil {
 		return fmt.Errorf("failed to stop Ralph: %w", err)
 	}
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+	if waitForExit(pf, cfg.Agent.GracePeriod+5*time.Second) {
+		return nil
+	}
+	color.Yellow("Process still running. Use --force to kill immediately.")
+	return nil
+}
 
-	// Wait for process to exit
+// waitForStopping waits until Ralph records in the PID file that it is
+// stopping, and reports whether it did
+func waitForStopping(pf *pidfile.PIDFile) bool {
+	deadline := time.Now().Add(stopAckTimeout)
+	for time.Now().Before(deadline) {
+		if info, err := pf.ReadInfo(); err == nil && info.Stopping {
+			return true
+		}
+		if running, _ := pf.IsRunning(); !running {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+// waitForExit waits up to timeout for the process to exit, printing progress,
+// and reports whether it did
+func waitForExit(pf *pidfile.PIDFile, timeout time.Duration) bool {
 	fmt.Print("Waiting for process to exit")
-	for i := 0; i < 30; i++ {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
 		time.Sleep(100 * time.Millisecond)
 		if running, _ := pf.IsRunning(); !running {
 			fmt.Println()
 			color.Green("Ralph stopped successfully")
 			_ = pf.Remove() // Clean up PID file
-			return nil
+			return true
 		}
 		fmt.Print(".")
 	}
-
 	fmt.Println()
-	if !stopForce {
-		color.Yellow("Process still running. Use --force to kill immediately.")
-	} else {
-		color.Red("Failed to stop process")
-	}
-
-	return nil
+	return false
 }
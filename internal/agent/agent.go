@@ -3,43 +3,71 @@ package agent
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
+
+	"github.com/kylemclaren/ralph/internal/procgroup"
+	"github.com/kylemclaren/ralph/internal/shell"
 )
 
 // Agent represents an AI coding agent
 type Agent struct {
-	Name    string
-	Command string
-	Args    []string
+	Driver  AgentDriver // how the agent is invoked and its output interpreted
 	Timeout time.Duration
 	Env     map[string]string // Additional environment variables
+	Dir     string            // Working directory (defaults to the current directory)
+	Output  io.Writer         // Where output is streamed (defaults to stdout/stderr)
+	Tap     io.Writer         // Also receives the output, e.g. for the live dashboard (optional)
+
+	// GracePeriod is how long the agent and the processes it started get to
+	// exit after being interrupted, when it times out or the loop is stopped
+	// immediately, before they are killed
+	GracePeriod time.Duration
+
+	// PromptFile is where the rendered prompt is saved before each execution.
+	// Agents that take the prompt as a file are given this path; if it is
+	// empty they get a temporary file instead.
+	PromptFile string
 }
 
+// DefaultCompletionPattern matches the completion marker at the very end of
+// the output, so quoting the prompt earlier does not count
+var DefaultCompletionPattern = regexp.MustCompile(`<promise>COMPLETE</promise>\s*$`)
+
 // Result holds the result of an agent execution
 type Result struct {
 	Output     string
+	Final      string // the agent's final message; the whole output for plain-text agents
 	ExitCode   int
 	Duration   time.Duration
-	IsComplete bool // true if output contains <promise>COMPLETE</promise>
+	IsComplete bool   // true if the final output matches the completion pattern
+	TimedOut   bool   // true if the agent was killed for exceeding its timeout
+	Usage      *Usage // token usage and cost, for agents that report it
 	Error      error
 }
 
 // New creates a new agent
-func New(name, command string, args []string, timeout time.Duration) *Agent {
+func New(driver AgentDriver, timeout time.Duration) *Agent {
 	return &Agent{
-		Name:    name,
-		Command: command,
-		Args:    args,
+		Driver:  driver,
 		Timeout: timeout,
 	}
 }
 
-// Execute runs the agent with the given prompt
+// Name returns the agent type
+func (a *Agent) Name() string {
+	return a.Driver.Name()
+}
+
+// Execute runs the agent with the given prompt, delivered the way its driver
+// expects
 func (a *Agent) Execute(ctx context.Context, prompt string) (*Result, error) {
 	start := time.Now()
 
@@ -50,37 +78,88 @@ func (a *Agent) Execute(ctx context.Context, prompt string) (*Result, error) {
 		defer cancel()
 	}
 
-	// Build the command with prompt
-	args := a.buildArgs(prompt)
-	cmd := exec.CommandContext(ctx, a.Command, args...)
+	// Save the prompt, then build the command, passing the prompt as an
+	// argument or file if needed
+	if a.PromptFile != "" {
+		if err := os.WriteFile(a.PromptFile, []byte(prompt), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write prompt file: %w", err)
+		}
+	}
+	promptArg := ""
+	switch a.Driver.PromptMode() {
+	case PromptArg:
+		promptArg = prompt
+	case PromptFile:
+		// The agent may run in another directory, so pass an absolute path
+		path, err := filepath.Abs(a.PromptFile)
+		if a.PromptFile == "" {
+			path, err = writeTempPrompt(prompt)
+			defer os.Remove(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		promptArg = path
+	}
+	program, args := a.Driver.Command(promptArg)
+	cmd := exec.CommandContext(ctx, program, args...)
+	cmd.Dir = a.Dir
+	release := procgroup.Configure(cmd, a.GracePeriod)
 
-	// Set environment variables (inherit current env + add custom)
+	// Set environment variables (inherit current env + driver + custom)
 	cmd.Env = os.Environ()
+	for k, v := range a.Driver.Env() {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
 	for k, v := range a.Env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
 
-	// Capture output while also streaming to stdout/stderr
+	// Capture output while also streaming to stdout/stderr. Structured output
+	// is rendered as readable text on the way.
 	var outputBuf bytes.Buffer
-	cmd.Stdout = io.MultiWriter(os.Stdout, &outputBuf)
-	cmd.Stderr = io.MultiWriter(os.Stderr, &outputBuf)
-	cmd.Stdin = strings.NewReader(prompt)
+	a.attachOutput(cmd, &outputBuf)
+	parser := a.Driver.NewParser(cmd.Stdout)
+	if parser != nil {
+		cmd.Stdout = parser
+	}
+	if a.Driver.PromptMode() == PromptStdin {
+		cmd.Stdin = strings.NewReader(prompt)
+	}
 
-	// Run the command
+	// Run the command. A process the agent left running, such as a dev
+	// server, may hold its output open after it exited; that is no error.
 	err := cmd.Run()
+	release()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		err = nil
+	}
+	if parser != nil {
+		parser.Flush()
+	}
 
 	result := &Result{
 		Output:   outputBuf.String(),
 		Duration: time.Since(start),
 	}
 
-	// Check exit code
+	// Only the final message may signal completion, so a quoted prompt or
+	// PRD cannot end the loop
+	final := result.Output
+	if parser != nil {
+		result.Usage = parser.Usage()
+		final = parser.FinalMessage()
+	}
+
+	// Check exit code. A timed-out agent is killed by the context, which
+	// surfaces as an ExitError, so the deadline must be checked first.
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
-		} else if ctx.Err() == context.DeadlineExceeded {
+		if ctx.Err() == context.DeadlineExceeded {
 			result.Error = fmt.Errorf("agent timed out after %v", a.Timeout)
+			result.TimedOut = true
 			result.ExitCode = -1
+		} else if exitErr, ok := err.(*exec.ExitError); ok {
+			result.ExitCode = exitErr.ExitCode()
 		} else {
 			result.Error = err
 			result.ExitCode = -1
@@ -88,11 +167,26 @@ func (a *Agent) Execute(ctx context.Context, prompt string) (*Result, error) {
 	}
 
 	// Check for completion marker
-	result.IsComplete = strings.Contains(result.Output, "<promise>COMPLETE</promise>")
+	result.Final = final
+	result.IsComplete = a.Driver.IsComplete(final)
 
 	return result, nil
 }
 
+// writeTempPrompt writes the prompt to a temporary file and returns its path
+func writeTempPrompt(prompt string) (string, error) {
+	f, err := os.CreateTemp("", "ralph-prompt-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create prompt file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(prompt); err != nil {
+		return f.Name(), fmt.Errorf("failed to write prompt file: %w", err)
+	}
+	return f.Name(), nil
+}
+
 // SetEnv sets additional environment variables for the agent
 func (a *Agent) SetEnv(env map[string]string) {
 	if a.Env == nil {
@@ -103,86 +197,60 @@ func (a *Agent) SetEnv(env map[string]string) {
 	}
 }
 
-// ExecuteWithStdin runs the agent by piping prompt via stdin
-func (a *Agent) ExecuteWithStdin(ctx context.Context, prompt string) (*Result, error) {
-	start := time.Now()
-
-	if a.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, a.Timeout)
-		defer cancel()
-	}
-
-	// For agents that accept prompt via stdin (like amp with piped input)
-	cmd := exec.CommandContext(ctx, a.Command, a.Args...)
-
-	// Set environment variables (inherit current env + add custom)
-	cmd.Env = os.Environ()
+// Clone returns a copy of the agent with its own environment map, so it can
+// be reconfigured (e.g. for a different working directory) independently
+func (a *Agent) Clone() *Agent {
+	clone := *a
+	clone.Env = make(map[string]string, len(a.Env))
 	for k, v := range a.Env {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+		clone.Env[k] = v
 	}
+	return &clone
+}
 
-	var outputBuf bytes.Buffer
-	cmd.Stdout = io.MultiWriter(os.Stdout, &outputBuf)
-	cmd.Stderr = io.MultiWriter(os.Stderr, &outputBuf)
-	cmd.Stdin = strings.NewReader(prompt)
-
-	err := cmd.Run()
-
-	result := &Result{
-		Output:   outputBuf.String(),
-		Duration: time.Since(start),
+// attachOutput captures command output into buf while streaming it to the
+// agent's Output writer, or stdout/stderr if none is set, and to its Tap
+func (a *Agent) attachOutput(cmd *exec.Cmd, buf *bytes.Buffer) {
+	// A stream parser gives stdout a writer of its own, so the sinks both
+	// streams share are written from two goroutines
+	var sinks io.Writer = buf
+	if a.Tap != nil {
+		sinks = io.MultiWriter(buf, a.Tap)
 	}
-
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
-		} else if ctx.Err() == context.DeadlineExceeded {
-			result.Error = fmt.Errorf("agent timed out after %v", a.Timeout)
-			result.ExitCode = -1
-		} else {
-			result.Error = err
-			result.ExitCode = -1
-		}
+	if a.Output != nil {
+		w := shell.NewSyncWriter(io.MultiWriter(a.Output, sinks))
+		cmd.Stdout = w
+		cmd.Stderr = w
+		return
 	}
-
-	result.IsComplete = strings.Contains(result.Output, "<promise>COMPLETE</promise>")
-
-	return result, nil
+	shared := shell.NewSyncWriter(sinks)
+	cmd.Stdout = io.MultiWriter(os.Stdout, shared)
+	cmd.Stderr = io.MultiWriter(os.Stderr, shared)
 }
 
-// buildArgs builds command arguments, adding prompt flag if needed
-func (a *Agent) buildArgs(prompt string) []string {
-	args := make([]string, len(a.Args))
-	copy(args, a.Args)
-
-	// Add prompt as -p flag for most agents
-	switch a.Name {
-	case "claude-code":
-		args = append(args, "-p", prompt)
-	case "amp":
-		// amp uses stdin, handled separately
-		args = append(args, "-p", prompt)
-	case "opencode":
-		args = append(args, "-p", prompt)
-	case "codex":
-		args = append(args, "-p", prompt)
-	default:
-		// For custom agents, assume -p flag
-		args = append(args, "-p", prompt)
+// CommandString returns the full command string for display, with the
+// prompt shown as a placeholder
+func (a *Agent) CommandString() string {
+	program, args := a.Driver.Command("<prompt>")
+	if a.Driver.PromptMode() == PromptFile {
+		program, args = a.Driver.Command("<prompt-file>")
 	}
-
-	return args
+	cmd := strings.TrimSpace(program + " " + strings.Join(args, " "))
+	if a.Driver.PromptMode() == PromptStdin {
+		cmd += " < <prompt>"
+	}
+	return cmd
 }
 
-// CommandString returns the full command string for display
-func (a *Agent) CommandString() string {
-	return fmt.Sprintf("%s %s", a.Command, strings.Join(a.Args, " "))
+// Program returns the executable the agent runs
+func (a *Agent) Program() string {
+	program, _ := a.Driver.Command("")
+	return program
 }
 
 // Available checks if the agent command is available
 func (a *Agent) Available() bool {
-	_, err := exec.LookPath(a.Command)
+	_, err := exec.LookPath(a.Program())
 	return err == nil
 }
 
@@ -0,0 +1,209 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PromptMode is how a driver hands the rendered prompt to its agent
+type PromptMode string
+
+const (
+	PromptArg   PromptMode = "arg"   // appended as the last command-line argument
+	PromptStdin PromptMode = "stdin" // piped on standard input
+	PromptFile  PromptMode = "file"  // written to a file whose path is the last argument
+)
+
+// AgentDriver knows how to run one kind of coding agent
+type AgentDriver interface {
+	// Name returns the agent type the driver was registered as
+	Name() string
+
+	// Command returns the program and arguments for one execution. prompt
+	// is the prompt text for PromptArg, the prompt file path for PromptFile,
+	// and empty for PromptStdin.
+	Command(prompt string) (string, []string)
+
+	// PromptMode returns how the prompt is delivered
+	PromptMode() PromptMode
+
+	// Env returns extra environment variables for the agent
+	Env() map[string]string
+
+	// NewParser wraps the agent's stdout, rendering it to out. It returns nil
+	// if the agent prints plain text.
+	NewParser(out io.Writer) OutputParser
+
+	// IsComplete reports whether the agent's final output signals that all
+	// stories are complete
+	IsComplete(final string) bool
+}
+
+// OutputParser consumes an agent's structured stdout
+type OutputParser interface {
+	io.Writer
+
+	// Flush handles any buffered partial output once the agent exits
+	Flush()
+
+	// FinalMessage returns the agent's final message
+	FinalMessage() string
+
+	// Usage returns the token usage and cost the agent reported, or nil
+	Usage() *Usage
+}
+
+// DriverOptions carries the agent configuration a driver is built from
+type DriverOptions struct {
+	Command           string   // command line, required for custom agents
+	Flags             []string // extra flags appended before the prompt
+	PromptMode        string   // overrides the driver's prompt mode when set
+	CompletionPattern string   // overrides DefaultCompletionPattern when set
+	Env               []string // extra KEY=VALUE environment variables
+}
+
+// DriverFactory builds a driver from the agent configuration
+type DriverFactory func(opts DriverOptions) (AgentDriver, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]DriverFactory)
+)
+
+// Register makes a driver available under the given agent type
+func Register(name string, factory DriverFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// NewDriver looks up the driver registered for the agent type and builds it
+func NewDriver(name string, opts DriverOptions) (AgentDriver, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown agent type: %s (available: %s)", name, strings.Join(Drivers(), ", "))
+	}
+	return factory(opts)
+}
+
+// Drivers returns the registered agent types in alphabetical order
+func Drivers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register("claude-code", func(opts DriverOptions) (AgentDriver, error) {
+		d, err := newCLIDriver("claude-code", "claude", []string{"--dangerously-skip-permissions", "-p", "--output-format", "stream-json", "--verbose"}, PromptStdin, opts)
+		if err != nil {
+			return nil, err
+		}
+		d.parser = func(out io.Writer) OutputParser { return newStreamParser(out) }
+		return d, nil
+	})
+	Register("amp", func(opts DriverOptions) (AgentDriver, error) {
+		return newCLIDriver("amp", "amp", []string{"--dangerously-allow-all"}, PromptStdin, opts)
+	})
+	Register("opencode", func(opts DriverOptions) (AgentDriver, error) {
+		return newCLIDriver("opencode", "opencode", []string{"run"}, PromptArg, opts)
+	})
+	Register("codex", func(opts DriverOptions) (AgentDriver, error) {
+		return newCLIDriver("codex", "codex", []string{"exec", "--full-auto"}, PromptArg, opts)
+	})
+	Register("custom", func(opts DriverOptions) (AgentDriver, error) {
+		parts := strings.Fields(opts.Command)
+		if len(parts) == 0 {
+			return nil, fmt.Errorf("custom agent type requires agent.command to be set")
+		}
+		return newCLIDriver("custom", parts[0], parts[1:], PromptStdin, opts)
+	})
+}
+
+// cliDriver runs an agent CLI with fixed arguments, the configured flags and
+// the prompt
+type cliDriver struct {
+	name       string
+	program    string
+	args       []string
+	mode       PromptMode
+	env        map[string]string
+	completion *regexp.Regexp
+	parser     func(out io.Writer) OutputParser
+}
+
+// newCLIDriver builds a driver for program, applying the configured flags,
+// prompt mode, completion pattern and environment
+func newCLIDriver(name, program string, args []string, mode PromptMode, opts DriverOptions) (*cliDriver, error) {
+	d := &cliDriver{
+		name:       name,
+		program:    program,
+		args:       append(append([]string(nil), args...), opts.Flags...),
+		mode:       mode,
+		env:        make(map[string]string, len(opts.Env)),
+		completion: DefaultCompletionPattern,
+	}
+
+	switch m := PromptMode(opts.PromptMode); m {
+	case "":
+	case PromptArg, PromptStdin, PromptFile:
+		d.mode = m
+	default:
+		return nil, fmt.Errorf("unknown prompt mode: %s (expected arg, stdin or file)", opts.PromptMode)
+	}
+
+	if opts.CompletionPattern != "" {
+		re, err := regexp.Compile(opts.CompletionPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid completion pattern: %w", err)
+		}
+		d.completion = re
+	}
+
+	for _, kv := range opts.Env {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid agent env entry %q (expected KEY=VALUE)", kv)
+		}
+		d.env[k] = v
+	}
+
+	return d, nil
+}
+
+func (d *cliDriver) Name() string { return d.name }
+
+func (d *cliDriver) Command(prompt string) (string, []string) {
+	args := append([]string(nil), d.args...)
+	if d.mode != PromptStdin {
+		args = append(args, prompt)
+	}
+	return d.program, args
+}
+
+func (d *cliDriver) PromptMode() PromptMode { return d.mode }
+
+func (d *cliDriver) Env() map[string]string { return d.env }
+
+func (d *cliDriver) NewParser(out io.Writer) OutputParser {
+	if d.parser == nil {
+		return nil
+	}
+	return d.parser(out)
+}
+
+func (d *cliDriver) IsComplete(final string) bool {
+	return d.completion.MatchString(final)
+}
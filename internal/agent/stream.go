@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// streamEvent is one line of Claude Code's --output-format stream-json output
+type streamEvent struct {
+	Type    string `json:"type"` // system, assistant, user, result
+	Subtype string `json:"subtype"`
+	Model   string `json:"model"`
+	Message struct {
+		Content []streamContent `json:"content"`
+	} `json:"message"`
+}
+
+// streamContent is a content block of an assistant or user message
+type streamContent struct {
+	Type    string          `json:"type"` // text, tool_use, tool_result
+	Text    string          `json:"text"`
+	Name    string          `json:"name"`
+	Input   json.RawMessage `json:"input"`
+	Content json.RawMessage `json:"content"`
+	IsError bool            `json:"is_error"`
+}
+
+// streamParser consumes Claude Code's stream-json events, renders them as
+// readable output, and keeps the final assistant message and usage
+type streamParser struct {
+	out         io.Writer
+	buf         []byte
+	lastMessage string        // text of the most recent assistant message
+	result      *claudeResult // final result event, if one was seen
+}
+
+func newStreamParser(out io.Writer) *streamParser {
+	return &streamParser{out: out}
+}
+
+// Write buffers p and handles every complete line as an event
+func (s *streamParser) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		s.handleLine(s.buf[:i])
+		s.buf = s.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush handles a trailing line without a newline
+func (s *streamParser) Flush() {
+	if len(s.buf) > 0 {
+		s.handleLine(s.buf)
+		s.buf = nil
+	}
+}
+
+// FinalMessage returns the agent's final assistant message
+func (s *streamParser) FinalMessage() string {
+	if s.result != nil && s.result.Result != "" {
+		return s.result.Result
+	}
+	return s.lastMessage
+}
+
+// Usage returns the usage reported in the result event, or nil
+func (s *streamParser) Usage() *Usage {
+	if s.result == nil {
+		return nil
+	}
+	return s.result.usage()
+}
+
+func (s *streamParser) handleLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+
+	var event streamEvent
+	if line[0] != '{' || json.Unmarshal(line, &event) != nil || event.Type == "" {
+		// Not an event (e.g. a warning printed by the CLI): pass it through
+		fmt.Fprintf(s.out, "%s\n", line)
+		return
+	}
+
+	switch event.Type {
+	case "system":
+		if event.Subtype == "init" && event.Model != "" {
+			fmt.Fprintln(s.out, color.HiBlackString("● %s", event.Model))
+		}
+	case "assistant":
+		var texts []string
+		for _, c := range event.Message.Content {
+			switch c.Type {
+			case "text":
+				if text := strings.TrimSpace(c.Text); text != "" {
+					texts = append(texts, text)
+					fmt.Fprintln(s.out, text)
+				}
+			case "tool_use":
+				fmt.Fprintf(s.out, "%s %s\n", color.CyanString("▸ %s", c.Name), color.HiBlackString(summarizeInput(c.Input)))
+			}
+		}
+		if len(texts) > 0 {
+			s.lastMessage = strings.Join(texts, "\n")
+		}
+	case "user":
+		for _, c := range event.Message.Content {
+			if c.Type == "tool_result" && c.IsError {
+				fmt.Fprintln(s.out, color.RedString("  ✗ %s", firstLine(toolResultText(c.Content), 120)))
+			}
+		}
+	case "result":
+		var res claudeResult
+		if err := json.Unmarshal(line, &res); err == nil {
+			s.result = &res
+			if res.IsError {
+				fmt.Fprintln(s.out, color.RedString("✗ %s: %s", res.Subtype, res.Result))
+			}
+		}
+	}
+}
+
+// summarizeInput picks the most telling field of a tool call's input
+func summarizeInput(input json.RawMessage) string {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(input, &fields); err != nil {
+		return ""
+	}
+	for _, key := range []string{"command", "file_path", "path", "pattern", "url", "query", "description", "prompt"} {
+		if v, ok := fields[key].(string); ok && v != "" {
+			return firstLine(v, 100)
+		}
+	}
+	return ""
+}
+
+// toolResultText extracts the text of a tool result, which is either a
+// string or a list of content blocks
+func toolResultText(content json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+	var blocks []streamContent
+	if err := json.Unmarshal(content, &blocks); err == nil {
+		var parts []string
+		for _, b := range blocks {
+			if b.Text != "" {
+				parts = append(parts, b.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return string(content)
+}
+
+// firstLine returns the first line of s, cut to at most max runes
+func firstLine(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i] + " …"
+	}
+	if r := []rune(s); len(r) > max {
+		s = string(r[:max]) + "…"
+	}
+	return s
+}
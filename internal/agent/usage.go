@@ -0,0 +1,78 @@
+package agent
+
+import "fmt"
+
+// Usage holds the token usage and cost an agent reported for one execution
+type Usage struct {
+	InputTokens         int     `json:"inputTokens"`
+	OutputTokens        int     `json:"outputTokens"`
+	CacheCreationTokens int     `json:"cacheCreationTokens,omitempty"`
+	CacheReadTokens     int     `json:"cacheReadTokens,omitempty"`
+	CostUSD             float64 `json:"costUsd"`
+}
+
+// Tokens returns the total number of tokens, including cached ones
+func (u *Usage) Tokens() int {
+	if u == nil {
+		return 0
+	}
+	return u.InputTokens + u.OutputTokens + u.CacheCreationTokens + u.CacheReadTokens
+}
+
+// Add accumulates other into u
+func (u *Usage) Add(other *Usage) {
+	if other == nil {
+		return
+	}
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationTokens += other.CacheCreationTokens
+	u.CacheReadTokens += other.CacheReadTokens
+	u.CostUSD += other.CostUSD
+}
+
+// String formats the usage for display, e.g. "$0.42 (123.4k tokens)"
+func (u *Usage) String() string {
+	if u == nil {
+		return "-"
+	}
+	return fmt.Sprintf("$%.2f (%s tokens)", u.CostUSD, FormatTokens(u.Tokens()))
+}
+
+// FormatTokens abbreviates a token count, e.g. 1234567 -> "1.2M"
+func FormatTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1_000)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
+
+// claudeResult is the final event of Claude Code's stream-json output
+type claudeResult struct {
+	Type         string  `json:"type"`
+	Subtype      string  `json:"subtype"`
+	IsError      bool    `json:"is_error"`
+	Result       string  `json:"result"`
+	TotalCostUSD float64 `json:"total_cost_usd"`
+	Usage        struct {
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+}
+
+// usage converts the result's token counts and cost into a Usage
+func (r *claudeResult) usage() *Usage {
+	return &Usage{
+		InputTokens:         r.Usage.InputTokens,
+		OutputTokens:        r.Usage.OutputTokens,
+		CacheCreationTokens: r.Usage.CacheCreationInputTokens,
+		CacheReadTokens:     r.Usage.CacheReadInputTokens,
+		CostUSD:             r.TotalCostUSD,
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
@@ -15,7 +17,9 @@ type Config struct {
 	Agent         AgentConfig         `mapstructure:"agent"`
 	Loop          LoopConfig          `mapstructure:"loop"`
 	Paths         PathsConfig         `mapstructure:"paths"`
+	Progress      ProgressConfig      `mapstructure:"progress"`
 	Hooks         HooksConfig         `mapstructure:"hooks"`
+	Verify        VerifyConfig        `mapstructure:"verify"`
 	Notifications NotificationsConfig `mapstructure:"notifications"`
 }
 
@@ -25,13 +29,36 @@ type AgentConfig struct {
 	Command string        `mapstructure:"command"` // custom command template
 	Flags   []string      `mapstructure:"flags"`   // additional flags
 	Timeout time.Duration `mapstructure:"timeout"` // max time per iteration
+
+	// GracePeriod is how long an interrupted agent gets to exit before it is
+	// killed, together with the processes it started
+	GracePeriod time.Duration `mapstructure:"gracePeriod"`
+
+	// PromptMode overrides how the prompt is delivered: arg, stdin or file.
+	// Each agent type has its own default.
+	PromptMode string `mapstructure:"promptMode"`
+
+	// Env holds extra KEY=VALUE environment variables for the agent
+	Env []string `mapstructure:"env"`
+
+	// CompletionPattern is a regular expression matched against the agent's
+	// final output to detect that all stories are complete. It should be
+	// anchored to the end ($) so quoted prompts do not match.
+	CompletionPattern string `mapstructure:"completionPattern"`
 }
 
 // LoopConfig configures the Ralph loop behavior
 type LoopConfig struct {
-	MaxIterations      int           `mapstructure:"maxIterations"`
-	SleepBetween       time.Duration `mapstructure:"sleepBetween"`
-	StopOnFirstFailure bool          `mapstructure:"stopOnFirstFailure"`
+	MaxIterations       int           `mapstructure:"maxIterations"`
+	SleepBetween        time.Duration `mapstructure:"sleepBetween"`
+	StopOnFirstFailure  bool          `mapstructure:"stopOnFirstFailure"`
+	MaxRetries          int           `mapstructure:"maxRetries"`          // consecutive failed iterations to retry before stopping
+	RetryBackoff        time.Duration `mapstructure:"retryBackoff"`        // initial delay after a failed iteration, doubled per retry
+	MaxBackoff          time.Duration `mapstructure:"maxBackoff"`          // upper bound for the retry delay
+	MaxAttemptsPerStory int           `mapstructure:"maxAttemptsPerStory"` // iterations a story may take without passing (0 = unlimited)
+	StallPolicy         string        `mapstructure:"stallPolicy"`         // what to do with a stalled story: skip, stop, block
+	MaxCostUSD          float64       `mapstructure:"maxCostUSD"`          // stop once a run has spent this much (0 = unlimited, claude-code only)
+	MaxTokens           int           `mapstructure:"maxTokens"`           // stop once a run has used this many tokens (0 = unlimited, claude-code only)
 }
 
 // PathsConfig configures file paths
@@ -39,45 +66,127 @@ type PathsConfig struct {
 	PRD      string `mapstructure:"prd"`
 	Progress string `mapstructure:"progress"`
 	Prompt   string `mapstructure:"prompt"`
+	Prompts  string `mapstructure:"prompts"` // partials and per-story prompt templates
+	Runs     string `mapstructure:"runs"`    // run history directory
+	Archive  string `mapstructure:"archive"` // raw progress logs saved by compaction
+}
+
+// ProgressConfig configures progress log compaction
+type ProgressConfig struct {
+	MaxBytes    int  `mapstructure:"maxBytes"`    // compact the log before an iteration once it is larger (0 = never)
+	KeepEntries int  `mapstructure:"keepEntries"` // most recent entries kept verbatim when compacting
+	UseAgent    bool `mapstructure:"useAgent"`    // have the configured agent write the summary
 }
 
 // HooksConfig configures lifecycle hooks
 type HooksConfig struct {
-	Enabled     bool     `mapstructure:"enabled"`
-	OnStart     []string `mapstructure:"onStart"`
-	OnIteration []string `mapstructure:"onIteration"`
-	OnComplete  []string `mapstructure:"onComplete"`
-	OnFailure   []string `mapstructure:"onFailure"`
+	Enabled         bool         `mapstructure:"enabled"`
+	OnStart         []HookConfig `mapstructure:"onStart"`
+	OnIteration     []HookConfig `mapstructure:"onIteration"`
+	AfterIteration  []HookConfig `mapstructure:"afterIteration"`
+	OnStoryComplete []HookConfig `mapstructure:"onStoryComplete"`
+	OnStoryFailed   []HookConfig `mapstructure:"onStoryFailed"`
+	OnComplete      []HookConfig `mapstructure:"onComplete"`
+	OnFailure       []HookConfig `mapstructure:"onFailure"`
+	OnStop          []HookConfig `mapstructure:"onStop"`
+}
+
+// HookEvent is the list of hooks configured for one event
+type HookEvent struct {
+	Name  string // config key, e.g. "onIteration"
+	Hooks []HookConfig
+}
+
+// Events returns the hooks of every event in lifecycle order
+func (h HooksConfig) Events() []HookEvent {
+	return []HookEvent{
+		{"onStart", h.OnStart},
+		{"onIteration", h.OnIteration},
+		{"afterIteration", h.AfterIteration},
+		{"onStoryComplete", h.OnStoryComplete},
+		{"onStoryFailed", h.OnStoryFailed},
+		{"onComplete", h.OnComplete},
+		{"onFailure", h.OnFailure},
+		{"onStop", h.OnStop},
+	}
+}
+
+// HookConfig configures a single hook. In YAML a hook is either a command
+// string or an object with these fields.
+type HookConfig struct {
+	Run             string        `mapstructure:"run"`             // command line, run through the shell
+	Timeout         time.Duration `mapstructure:"timeout"`         // max run time (0 = unlimited)
+	Cwd             string        `mapstructure:"cwd"`             // working directory
+	Env             []string      `mapstructure:"env"`             // extra KEY=VALUE environment variables
+	ContinueOnError bool          `mapstructure:"continueOnError"` // report a failure but keep going
 }
 
-// NotificationsConfig configures notifications
+// VerifyConfig configures how Ralph verifies stories the agent marks as passing
+type VerifyConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	RequireCommit    bool          `mapstructure:"requireCommit"`    // HEAD must move during the iteration
+	RequireStoryID   bool          `mapstructure:"requireStoryId"`   // a new commit message must mention the story ID
+	RequireCleanTree bool          `mapstructure:"requireCleanTree"` // no uncommitted changes outside Ralph's own files
+	CheckTimeout     time.Duration `mapstructure:"checkTimeout"`     // max time per acceptance check command
+}
+
+// NotificationsConfig configures webhook notifications
 type NotificationsConfig struct {
-	Enabled bool   `mapstructure:"enabled"`
-	Webhook string `mapstructure:"webhook"`
+	Enabled      bool          `mapstructure:"enabled"`
+	Webhook      string        `mapstructure:"webhook"`
+	Format       string        `mapstructure:"format"`       // auto, slack, discord or json
+	Events       []string      `mapstructure:"events"`       // events to send (default: all)
+	Retries      int           `mapstructure:"retries"`      // extra attempts after a failed delivery
+	RetryBackoff time.Duration `mapstructure:"retryBackoff"` // delay before the first retry, doubling after each
+	Timeout      time.Duration `mapstructure:"timeout"`      // max time per request
 }
 
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
 		Agent: AgentConfig{
-			Type:    "claude-code",
-			Timeout: 30 * time.Minute,
+			Type:        "claude-code",
+			Timeout:     30 * time.Minute,
+			GracePeriod: 10 * time.Second,
 		},
 		Loop: LoopConfig{
 			MaxIterations:      25,
 			SleepBetween:       2 * time.Second,
 			StopOnFirstFailure: false,
+			MaxRetries:         3,
+			RetryBackoff:       10 * time.Second,
+			MaxBackoff:         5 * time.Minute,
+			StallPolicy:        "block",
 		},
 		Paths: PathsConfig{
 			PRD:      ".ralph/prd.json",
 			Progress: ".ralph/progress.txt",
 			Prompt:   ".ralph/prompt.md",
+			Prompts:  ".ralph/prompts",
+			Runs:     ".ralph/runs",
+			Archive:  ".ralph/archive",
+		},
+		Progress: ProgressConfig{
+			MaxBytes:    0,
+			KeepEntries: 3,
+			UseAgent:    false,
 		},
 		Hooks: HooksConfig{
 			Enabled: true,
 		},
+		Verify: VerifyConfig{
+			Enabled:          false,
+			RequireCommit:    true,
+			RequireStoryID:   true,
+			RequireCleanTree: true,
+			CheckTimeout:     10 * time.Minute,
+		},
 		Notifications: NotificationsConfig{
-			Enabled: false,
+			Enabled:      false,
+			Format:       "auto",
+			Retries:      3,
+			RetryBackoff: time.Second,
+			Timeout:      10 * time.Second,
 		},
 	}
 }
@@ -112,52 +221,70 @@ func Load(cfgFile string) (*Config, error) {
 
 	// Unmarshal into config struct
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := viper.Unmarshal(&cfg, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		// Before the comma splitting of other lists, which would break a
+		// command such as "echo a, b" in two
+		stringToHookConfig,
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))); err != nil {
 		return nil, fmt.Errorf("error parsing config: %w", err)
 	}
 
 	return &cfg, nil
 }
 
+// stringToHookConfig lets a hook be written as a plain command string, and an
+// event with a single hook as that hook alone
+func stringToHookConfig(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String {
+		return data, nil
+	}
+	switch to {
+	case reflect.TypeOf(HookConfig{}):
+		return HookConfig{Run: data.(string)}, nil
+	case reflect.TypeOf([]HookConfig{}):
+		return []HookConfig{{Run: data.(string)}}, nil
+	}
+	return data, nil
+}
+
 func setDefaults() {
 	defaults := DefaultConfig()
 
 	viper.SetDefault("agent.type", defaults.Agent.Type)
 	viper.SetDefault("agent.timeout", defaults.Agent.Timeout)
+	viper.SetDefault("agent.gracePeriod", defaults.Agent.GracePeriod)
 	viper.SetDefault("loop.maxIterations", defaults.Loop.MaxIterations)
 	viper.SetDefault("loop.sleepBetween", defaults.Loop.SleepBetween)
 	viper.SetDefault("loop.stopOnFirstFailure", defaults.Loop.StopOnFirstFailure)
+	viper.SetDefault("loop.maxRetries", defaults.Loop.MaxRetries)
+	viper.SetDefault("loop.retryBackoff", defaults.Loop.RetryBackoff)
+	viper.SetDefault("loop.maxBackoff", defaults.Loop.MaxBackoff)
+	viper.SetDefault("loop.maxAttemptsPerStory", defaults.Loop.MaxAttemptsPerStory)
+	viper.SetDefault("loop.stallPolicy", defaults.Loop.StallPolicy)
+	viper.SetDefault("loop.maxCostUSD", defaults.Loop.MaxCostUSD)
+	viper.SetDefault("loop.maxTokens", defaults.Loop.MaxTokens)
 	viper.SetDefault("paths.prd", defaults.Paths.PRD)
 	viper.SetDefault("paths.progress", defaults.Paths.Progress)
 	viper.SetDefault("paths.prompt", defaults.Paths.Prompt)
+	viper.SetDefault("paths.prompts", defaults.Paths.Prompts)
+	viper.SetDefault("paths.runs", defaults.Paths.Runs)
+	viper.SetDefault("paths.archive", defaults.Paths.Archive)
+	viper.SetDefault("progress.maxBytes", defaults.Progress.MaxBytes)
+	viper.SetDefault("progress.keepEntries", defaults.Progress.KeepEntries)
+	viper.SetDefault("progress.useAgent", defaults.Progress.UseAgent)
 	viper.SetDefault("hooks.enabled", defaults.Hooks.Enabled)
+	viper.SetDefault("verify.enabled", defaults.Verify.Enabled)
+	viper.SetDefault("verify.requireCommit", defaults.Verify.RequireCommit)
+	viper.SetDefault("verify.requireStoryId", defaults.Verify.RequireStoryID)
+	viper.SetDefault("verify.requireCleanTree", defaults.Verify.RequireCleanTree)
+	viper.SetDefault("verify.checkTimeout", defaults.Verify.CheckTimeout)
 	viper.SetDefault("notifications.enabled", defaults.Notifications.Enabled)
-}
-
-// GetAgentCommand returns the full command for the configured agent
-func (c *Config) GetAgentCommand() (string, []string, error) {
-	switch c.Agent.Type {
-	case "claude-code":
-		return "claude", append([]string{"--dangerously-skip-permissions"}, c.Agent.Flags...), nil
-	case "amp":
-		return "amp", append([]string{"--dangerously-allow-all"}, c.Agent.Flags...), nil
-	case "opencode":
-		return "opencode", c.Agent.Flags, nil
-	case "codex":
-		return "codex", c.Agent.Flags, nil
-	case "custom":
-		if c.Agent.Command == "" {
-			return "", nil, fmt.Errorf("custom agent type requires agent.command to be set")
-		}
-		// Parse custom command
-		parts := strings.Fields(c.Agent.Command)
-		if len(parts) == 0 {
-			return "", nil, fmt.Errorf("invalid custom command")
-		}
-		return parts[0], append(parts[1:], c.Agent.Flags...), nil
-	default:
-		return "", nil, fmt.Errorf("unknown agent type: %s", c.Agent.Type)
-	}
+	viper.SetDefault("notifications.format", defaults.Notifications.Format)
+	viper.SetDefault("notifications.retries", defaults.Notifications.Retries)
+	viper.SetDefault("notifications.retryBackoff", defaults.Notifications.RetryBackoff)
+	viper.SetDefault("notifications.timeout", defaults.Notifications.Timeout)
 }
 
 // EnsureDirectories creates necessary directories for Ralph files
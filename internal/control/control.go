@@ -0,0 +1,133 @@
+// Package control lets other ralph commands steer a running loop through a
+// unix socket next to the PID file. Each connection carries one JSON request
+// and its response.
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SocketName is the control socket's file name, in the directory of the PID
+// file
+const SocketName = ".ralph.sock"
+
+// Commands a running loop accepts
+const (
+	CommandPause  = "pause"
+	CommandResume = "resume"
+	CommandSkip   = "skip"
+)
+
+// ErrNotListening means no running loop accepts control requests
+var ErrNotListening = errors.New("ralph is not accepting control requests")
+
+// timeout bounds a request, so a stuck loop cannot hang the command sending it
+const timeout = 5 * time.Second
+
+// Request asks the running loop to do something
+type Request struct {
+	Command string `json:"command"`
+	Story   string `json:"story,omitempty"` // story to skip (optional)
+}
+
+// Response is the loop's answer to a request
+type Response struct {
+	Message string `json:"message,omitempty"` // what the loop did
+	Error   string `json:"error,omitempty"`   // why it could not
+}
+
+// Handler carries out a request and describes what it did
+type Handler func(Request) (string, error)
+
+// Path returns the control socket's path in dir. If dir is empty the path is
+// relative to the working directory, like the PID file, which also keeps it
+// short enough for a socket address.
+func Path(dir string) string {
+	if dir == "" {
+		return SocketName
+	}
+	return filepath.Join(dir, SocketName)
+}
+
+// Server accepts control requests until it is closed
+type Server struct {
+	path string
+	ln   net.Listener
+}
+
+// Listen starts accepting requests on the socket at path in the background.
+// A socket left behind by a loop that did not exit cleanly is replaced; the
+// PID file keeps two loops from running at once.
+func Listen(path string, h Handler) (*Server, error) {
+	_ = os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open control socket: %w", err)
+	}
+
+	s := &Server{path: path, ln: ln}
+	go s.serve(h)
+	return s, nil
+}
+
+// Close stops accepting requests and removes the socket
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	_ = os.Remove(s.path)
+	return err
+}
+
+func (s *Server) serve(h Handler) {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go handle(conn, h)
+	}
+}
+
+func handle(conn net.Conn, h Handler) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	var req Request
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		resp.Error = fmt.Sprintf("invalid request: %v", err)
+	} else if msg, err := h(req); err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Message = msg
+	}
+	_ = json.NewEncoder(conn).Encode(resp)
+}
+
+// Send sends a request to the loop listening on the socket at path and
+// returns its message
+func Send(path string, req Request) (string, error) {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return "", ErrNotListening
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.Error != "" {
+		return "", errors.New(resp.Error)
+	}
+	return resp.Message, nil
+}
@@ -0,0 +1,274 @@
+// Package git wraps the git command line for the repository operations Ralph
+// performs itself: branch management, worktrees, merges, commit checks and
+// the repository context shown in prompts.
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrMergeConflict is returned (wrapped in a *MergeConflictError) when a merge
+// stops because of conflicts
+var ErrMergeConflict = errors.New("merge conflict")
+
+// MergeConflictError lists the files that conflicted during a merge
+type MergeConflictError struct {
+	Branch string
+	Files  []string
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("merging %s: conflicts in %s", e.Branch, strings.Join(e.Files, ", "))
+}
+
+func (e *MergeConflictError) Unwrap() error {
+	return ErrMergeConflict
+}
+
+// Run executes git with the given arguments in dir and returns trimmed stdout
+func Run(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return strings.TrimSpace(stdout.String()), fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Available checks if the git command is available
+func Available() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
+
+// Root returns the top-level directory of the working tree containing dir
+func Root(dir string) (string, error) {
+	return Run(dir, "rev-parse", "--show-toplevel")
+}
+
+// CurrentBranch returns the checked out branch name ("HEAD" when detached).
+// It also works on a branch that has no commits yet.
+func CurrentBranch(dir string) (string, error) {
+	branch, err := Run(dir, "symbolic-ref", "--short", "-q", "HEAD")
+	if err != nil {
+		if _, headErr := HeadCommit(dir); headErr == nil {
+			return "HEAD", nil
+		}
+		return "", err
+	}
+	return branch, nil
+}
+
+// HeadCommit returns the full hash of HEAD
+func HeadCommit(dir string) (string, error) {
+	return Run(dir, "rev-parse", "HEAD")
+}
+
+// BranchExists checks if a local branch exists
+func BranchExists(dir, branch string) bool {
+	_, err := Run(dir, "show-ref", "--verify", "--quiet", "refs/heads/"+branch)
+	return err == nil
+}
+
+// Checkout switches to an existing branch
+func Checkout(dir, branch string) error {
+	_, err := Run(dir, "checkout", branch)
+	return err
+}
+
+// CreateBranch creates a new branch from HEAD and switches to it
+func CreateBranch(dir, branch string) error {
+	_, err := Run(dir, "checkout", "-b", branch)
+	return err
+}
+
+// SwitchBranch checks out branch, creating it from HEAD if it does not exist
+func SwitchBranch(dir, branch string) error {
+	if BranchExists(dir, branch) {
+		return Checkout(dir, branch)
+	}
+	return CreateBranch(dir, branch)
+}
+
+// DeleteBranch force-deletes a local branch
+func DeleteBranch(dir, branch string) error {
+	_, err := Run(dir, "branch", "-D", branch)
+	return err
+}
+
+// IsTracked checks if path exists in the tree of the given revision
+func IsTracked(dir, rev, path string) bool {
+	_, err := Run(dir, "cat-file", "-e", rev+":"+filepath.ToSlash(path))
+	return err == nil
+}
+
+// HasStagedChanges checks if the index differs from HEAD
+func HasStagedChanges(dir string) bool {
+	_, err := Run(dir, "diff", "--cached", "--quiet")
+	return err != nil
+}
+
+// AddAll stages all changes in the working tree
+func AddAll(dir string) error {
+	_, err := Run(dir, "add", "-A")
+	return err
+}
+
+// Commit records staged changes with the given message
+func Commit(dir, message string) error {
+	_, err := Run(dir, "commit", "-q", "-m", message)
+	return err
+}
+
+// CommitMessages returns the full messages of the commits reachable from to
+// but not from from (or all commits reachable from to if from is empty),
+// newest first
+func CommitMessages(dir, from, to string) ([]string, error) {
+	rev := to
+	if from != "" {
+		rev = from + ".." + to
+	}
+	out, err := Run(dir, "log", "--format=%B%x00", rev)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []string
+	for _, msg := range strings.Split(out, "\x00") {
+		if msg = strings.TrimSpace(msg); msg != "" {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+// ModifiedFiles returns the tracked paths (relative to the repository root)
+// with staged or unstaged changes
+func ModifiedFiles(dir string) ([]string, error) {
+	out, err := Run(dir, "diff", "--name-only", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return lines(out), nil
+}
+
+// ChangedFiles returns the paths (relative to the repository root) that have
+// uncommitted changes, including untracked files that are not ignored
+func ChangedFiles(dir string) ([]string, error) {
+	files, err := ModifiedFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := Run(dir, "ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+	return append(files, lines(untracked)...), nil
+}
+
+// Log returns the last n commits of HEAD, one "<hash> <subject>" per line
+func Log(dir string, n int) (string, error) {
+	return Run(dir, "log", "--oneline", "-n", strconv.Itoa(n))
+}
+
+// DiffStat summarizes the uncommitted changes to tracked files
+func DiffStat(dir string) (string, error) {
+	return Run(dir, "diff", "--stat", "HEAD")
+}
+
+// lines splits command output into its non-empty lines
+func lines(out string) []string {
+	var result []string
+	for _, line := range strings.Split(out, "\n") {
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// AddWorktree creates a worktree at path on a new branch started from base
+func AddWorktree(dir, path, branch, base string) error {
+	_, err := Run(dir, "worktree", "add", "-q", "-b", branch, path, base)
+	return err
+}
+
+// RemoveWorktree removes a worktree, discarding any local changes in it
+func RemoveWorktree(dir, path string) error {
+	_, err := Run(dir, "worktree", "remove", "--force", path)
+	return err
+}
+
+// Merge merges branch into the current branch with a merge commit. On
+// conflicts the merge is aborted and a *MergeConflictError is returned.
+func Merge(dir, branch, message string) error {
+	_, err := Run(dir, "merge", "--no-ff", "-m", message, branch)
+	if err == nil {
+		return nil
+	}
+
+	conflicts, _ := Run(dir, "diff", "--name-only", "--diff-filter=U")
+	if conflicts == "" {
+		return err
+	}
+
+	_, _ = Run(dir, "merge", "--abort")
+	return &MergeConflictError{
+		Branch: branch,
+		Files:  strings.Split(conflicts, "\n"),
+	}
+}
+
+// Exclude adds a pattern to the repository's info/exclude file so it is
+// ignored without touching the tracked .gitignore
+func Exclude(dir, pattern string) error {
+	path, err := Run(dir, "rev-parse", "--git-path", "info/exclude")
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == pattern {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		pattern = "\n" + pattern
+	}
+	_, err = f.WriteString(pattern + "\n")
+	return err
+}
@@ -0,0 +1,358 @@
+// Package history persists a record of every Ralph run and its iterations
+// under .ralph/runs/<run-id>/, so runs can be audited after the fact.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kylemclaren/ralph/internal/agent"
+	"github.com/kylemclaren/ralph/internal/hooks"
+)
+
+// ErrNotFound is returned when a run or iteration does not exist
+var ErrNotFound = errors.New("not found")
+
+// File names used inside a run directory
+const (
+	RunFile        = "run.json"
+	IterationsDir  = "iterations"
+	IterationFile  = "iteration.json"
+	OutputFile     = "output.log"
+	LogFile        = "ralph.log" // console output of a detached run
+	PromptFile     = "prompt.md"
+	PRDBeforeFile  = "prd-before.json"
+	PRDAfterFile   = "prd-after.json"
+	LatestRunAlias = "latest"
+)
+
+// Run holds metadata for a single `ralph run` invocation
+type Run struct {
+	ID              string       `json:"id"`
+	StartedAt       time.Time    `json:"startedAt"`
+	EndedAt         *time.Time   `json:"endedAt,omitempty"`
+	Mode            string       `json:"mode"` // loop, once, parallel
+	Agent           string       `json:"agent"`
+	Branch          string       `json:"branch"`
+	PRDPath         string       `json:"prdPath"`
+	MaxIterations   int          `json:"maxIterations"`
+	Iterations      int          `json:"iterations"`
+	StoriesComplete int          `json:"storiesComplete"`
+	Success         bool         `json:"success"`
+	Reason          string       `json:"reason,omitempty"`
+	Error           string       `json:"error,omitempty"`
+	Usage           *agent.Usage `json:"usage,omitempty"` // total reported by the agent across iterations
+
+	dir string
+	mu  sync.Mutex
+}
+
+// Iteration holds metadata for a single agent execution within a run
+type Iteration struct {
+	Number     int          `json:"number"`
+	StoryID    string       `json:"storyId"`
+	StoryTitle string       `json:"storyTitle"`
+	Branch     string       `json:"branch,omitempty"`
+	StartedAt  time.Time    `json:"startedAt"`
+	EndedAt    time.Time    `json:"endedAt"`
+	Status     string       `json:"status"`
+	Message    string       `json:"message,omitempty"`
+	ExitCode   int          `json:"exitCode"`
+	TimedOut   bool         `json:"timedOut,omitempty"`
+	Complete   bool         `json:"complete,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	Usage      *agent.Usage `json:"usage,omitempty"`
+
+	Hooks []hooks.Result `json:"hooks,omitempty"` // onIteration hooks with their output
+}
+
+// Duration returns how long the iteration took
+func (i *Iteration) Duration() time.Duration {
+	return i.EndedAt.Sub(i.StartedAt)
+}
+
+// Store manages the runs directory
+type Store struct {
+	Dir string
+}
+
+// NewStore creates a store rooted at the given runs directory
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+// Start assigns an ID to the run unless it already has one, creates its
+// directory and writes run.json
+func (s *Store) Start(run *Run) error {
+	if run.StartedAt.IsZero() {
+		run.StartedAt = time.Now()
+	}
+	if run.ID == "" {
+		run.ID = s.NewID(run.StartedAt)
+	}
+
+	run.dir = filepath.Join(s.Dir, run.ID)
+	if err := os.MkdirAll(filepath.Join(run.dir, IterationsDir), 0755); err != nil {
+		return fmt.Errorf("failed to create run directory: %w", err)
+	}
+
+	return run.save()
+}
+
+// NewID returns an unused ID for a run started at t
+func (s *Store) NewID(t time.Time) string {
+	base := t.Format("20060102-150405")
+	id := base
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(s.Dir, id)); os.IsNotExist(err) {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// LogPath returns where the run with the given ID writes its console output
+// when detached
+func (s *Store) LogPath(id string) string {
+	return filepath.Join(s.Dir, id, LogFile)
+}
+
+// List returns all recorded runs, newest first
+func (s *Store) List() ([]*Run, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read runs directory: %w", err)
+	}
+
+	var runs []*Run
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		run, err := s.Get(e.Name())
+		if err != nil {
+			continue // Not a run directory, or a corrupt one
+		}
+		runs = append(runs, run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+
+	return runs, nil
+}
+
+// Get loads a run by ID. The ID "latest" resolves to the newest run.
+func (s *Store) Get(id string) (*Run, error) {
+	if id == LatestRunAlias {
+		runs, err := s.List()
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) == 0 {
+			return nil, fmt.Errorf("no runs recorded: %w", ErrNotFound)
+		}
+		return runs[0], nil
+	}
+
+	dir := filepath.Join(s.Dir, id)
+	data, err := os.ReadFile(filepath.Join(dir, RunFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("run %s: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to read run %s: %w", id, err)
+	}
+
+	run := &Run{dir: dir}
+	if err := json.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("failed to parse run %s: %w", id, err)
+	}
+
+	return run, nil
+}
+
+// Dir returns the run's directory
+func (r *Run) Dir() string {
+	return r.dir
+}
+
+// LogPath returns the console log of the run, written only when it ran
+// detached
+func (r *Run) LogPath() string {
+	return filepath.Join(r.dir, LogFile)
+}
+
+// IterationDir returns the directory holding the files for iteration n
+func (r *Run) IterationDir(n int) string {
+	return filepath.Join(r.dir, IterationsDir, fmt.Sprintf("%03d", n))
+}
+
+// PromptPath returns the path the rendered prompt of iteration n is written
+// to, creating the iteration directory
+func (r *Run) PromptPath(n int) (string, error) {
+	dir := r.IterationDir(n)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create iteration directory: %w", err)
+	}
+	return filepath.Join(dir, PromptFile), nil
+}
+
+// RecordIteration writes the iteration metadata, the agent's captured output
+// and the PRD before and after the iteration. PRD snapshots may be nil.
+func (r *Run) RecordIteration(it *Iteration, output string, prdBefore, prdAfter []byte) error {
+	if r == nil {
+		return nil
+	}
+
+	dir := r.IterationDir(it.Number)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create iteration directory: %w", err)
+	}
+
+	if err := writeJSON(filepath.Join(dir, IterationFile), it); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, OutputFile), []byte(output), 0644); err != nil {
+		return fmt.Errorf("failed to write iteration output: %w", err)
+	}
+	if prdBefore != nil {
+		if err := os.WriteFile(filepath.Join(dir, PRDBeforeFile), prdBefore, 0644); err != nil {
+			return fmt.Errorf("failed to write PRD snapshot: %w", err)
+		}
+	}
+	if prdAfter != nil {
+		if err := os.WriteFile(filepath.Join(dir, PRDAfterFile), prdAfter, 0644); err != nil {
+			return fmt.Errorf("failed to write PRD snapshot: %w", err)
+		}
+	}
+
+	r.mu.Lock()
+	if it.Number > r.Iterations {
+		r.Iterations = it.Number
+	}
+	if it.Usage != nil {
+		if r.Usage == nil {
+			r.Usage = &agent.Usage{}
+		}
+		r.Usage.Add(it.Usage)
+	}
+	r.mu.Unlock()
+
+	return r.save()
+}
+
+// Finish records the outcome of the run
+func (r *Run) Finish(success bool, reason string, iterations, storiesComplete int, runErr error) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	r.EndedAt = &now
+	r.Success = success
+	r.Reason = reason
+	r.Iterations = iterations
+	r.StoriesComplete = storiesComplete
+	if runErr != nil {
+		r.Error = runErr.Error()
+	}
+	r.mu.Unlock()
+
+	return r.save()
+}
+
+// LoadIterations loads the metadata of all recorded iterations in order
+func (r *Run) LoadIterations() ([]*Iteration, error) {
+	entries, err := os.ReadDir(filepath.Join(r.dir, IterationsDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read iterations: %w", err)
+	}
+
+	var iterations []*Iteration
+	for _, e := range entries {
+		n, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		it, err := r.LoadIteration(n)
+		if err != nil {
+			continue
+		}
+		iterations = append(iterations, it)
+	}
+
+	sort.Slice(iterations, func(i, j int) bool {
+		return iterations[i].Number < iterations[j].Number
+	})
+
+	return iterations, nil
+}
+
+// LoadIteration loads the metadata of iteration n
+func (r *Run) LoadIteration(n int) (*Iteration, error) {
+	data, err := os.ReadFile(filepath.Join(r.IterationDir(n), IterationFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("iteration %d of run %s: %w", n, r.ID, ErrNotFound)
+		}
+		return nil, err
+	}
+
+	var it Iteration
+	if err := json.Unmarshal(data, &it); err != nil {
+		return nil, fmt.Errorf("failed to parse iteration %d: %w", n, err)
+	}
+	return &it, nil
+}
+
+// ReadIterationFile reads one of the files recorded for iteration n
+func (r *Run) ReadIterationFile(n int, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(r.IterationDir(n), name))
+	if err != nil && os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s for iteration %d of run %s: %w", name, n, r.ID, ErrNotFound)
+	}
+	return data, err
+}
+
+// Duration returns how long the run took, or has been running so far
+func (r *Run) Duration() time.Duration {
+	if r.EndedAt == nil {
+		return time.Since(r.StartedAt)
+	}
+	return r.EndedAt.Sub(r.StartedAt)
+}
+
+// save writes run.json
+func (r *Run) save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return writeJSON(filepath.Join(r.dir, RunFile), r)
+}
+
+// writeJSON writes v as indented JSON to path
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", filepath.Base(path), err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -1,146 +1,349 @@
 package hooks
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/procgroup"
+	"github.com/kylemclaren/ralph/internal/shell"
 )
 
 // HookType represents the type of hook
 type HookType string
 
 const (
-	HookOnStart     HookType = "onStart"
-	HookOnIteration HookType = "onIteration"
-	HookOnComplete  HookType = "onComplete"
-	HookOnFailure   HookType = "onFailure"
+	HookOnStart         HookType = "onStart"         // before the first iteration
+	HookOnIteration     HookType = "onIteration"     // before each iteration's agent runs
+	HookAfterIteration  HookType = "afterIteration"  // after each iteration's agent and checks
+	HookOnStoryComplete HookType = "onStoryComplete" // a story flipped to passing
+	HookOnStoryFailed   HookType = "onStoryFailed"   // an iteration on a story failed or was rejected
+	HookOnComplete      HookType = "onComplete"      // all stories pass
+	HookOnFailure       HookType = "onFailure"       // the loop stopped without completing
+	HookOnStop          HookType = "onStop"          // the loop stopped on request or was interrupted (SIGINT/SIGTERM)
+)
+
+// Types lists every hook type in lifecycle order
+var Types = []HookType{
+	HookOnStart,
+	HookOnIteration,
+	HookAfterIteration,
+	HookOnStoryComplete,
+	HookOnStoryFailed,
+	HookOnComplete,
+	HookOnFailure,
+	HookOnStop,
+}
+
+// Variables hooks receive on top of the Ralph state (see claudecode.RalphEnv)
+const (
+	EnvHook             = "RALPH_HOOK"              // hook type being executed
+	EnvExitCode         = "RALPH_EXIT_CODE"         // afterIteration: agent exit code
+	EnvDuration         = "RALPH_DURATION"          // afterIteration: agent run time in seconds
+	EnvStatus           = "RALPH_STATUS"            // afterIteration: iteration status
+	EnvPRDChanged       = "RALPH_PRD_CHANGED"       // afterIteration: "true" if the agent edited the PRD
+	EnvFailureReason    = "RALPH_FAILURE_REASON"    // onStoryFailed, onFailure: what went wrong
+	EnvIterations       = "RALPH_ITERATIONS"        // onComplete: iterations run
+	EnvStoriesCompleted = "RALPH_STORIES_COMPLETED" // onComplete: stories passing
 )
 
+// maxOutput is how much of a hook's output is kept in its Result
+const maxOutput = 16 * 1024
+
+// Hook is a shell command run at a point of the loop's lifecycle
+type Hook struct {
+	Run             string        // command line, run with sh -c (cmd /C on Windows)
+	Timeout         time.Duration // max run time (0 = unlimited)
+	Dir             string        // working directory (default: the current directory)
+	Env             []string      // extra KEY=VALUE environment variables
+	ContinueOnError bool          // a failure is reported but does not stop the loop
+}
+
+// Result is the outcome of a single hook run, kept with the iteration record
+type Result struct {
+	Hook     HookType      `json:"hook"`
+	Command  string        `json:"command"`
+	ExitCode int           `json:"exitCode"`
+	Duration time.Duration `json:"duration"`
+	Output   string        `json:"output,omitempty"` // combined stdout and stderr, truncated to the last 16KB
+	Error    string        `json:"error,omitempty"`
+	Ignored  bool          `json:"ignored,omitempty"`  // failed, but continueOnError was set
+	Response *Response     `json:"response,omitempty"` // JSON object the hook printed, if any
+}
+
+// Response is a JSON object a hook may print as the last line of its stdout
+// to steer the iteration it runs for
+type Response struct {
+	Skip        bool   `json:"skip,omitempty"`        // onIteration: skip the story for the rest of the run
+	Story       string `json:"story,omitempty"`       // onIteration: work on this story instead
+	ExtraPrompt string `json:"extraPrompt,omitempty"` // onIteration: text appended to the prompt
+	MarkPassing *bool  `json:"markPassing,omitempty"` // afterIteration: false returns stories marked as passing to pending
+	Reason      string `json:"reason,omitempty"`      // why, shown to the user and recorded in the PRD
+}
+
+// Merge combines the responses of hooks run in order: any skip or
+// markPassing false wins, the last story wins, and extra prompts and reasons
+// are joined
+func Merge(results []Result) Response {
+	var merged Response
+	var extra, reasons []string
+	for _, r := range results {
+		resp := r.Response
+		if resp == nil {
+			continue
+		}
+		merged.Skip = merged.Skip || resp.Skip
+		if resp.Story != "" {
+			merged.Story = resp.Story
+		}
+		if resp.ExtraPrompt != "" {
+			extra = append(extra, resp.ExtraPrompt)
+		}
+		if resp.MarkPassing != nil && (merged.MarkPassing == nil || !*resp.MarkPassing) {
+			merged.MarkPassing = resp.MarkPassing
+		}
+		if resp.Reason != "" {
+			reasons = append(reasons, resp.Reason)
+		}
+	}
+	merged.ExtraPrompt = strings.Join(extra, "\n\n")
+	merged.Reason = strings.Join(reasons, "; ")
+	return merged
+}
+
+// parseResponse reads the response from the last non-empty line of stdout.
+// A line that looks like a JSON object but does not parse is an error, so a
+// malformed veto is not silently ignored.
+func parseResponse(stdout string) (*Response, error) {
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if !strings.HasPrefix(last, "{") || !strings.HasSuffix(last, "}") {
+		return nil, nil
+	}
+
+	var resp Response
+	if err := json.Unmarshal([]byte(last), &resp); err != nil {
+		return nil, fmt.Errorf("invalid JSON response %s: %w", last, err)
+	}
+	return &resp, nil
+}
+
+// respondsTo reports whether hooks of a type can steer their iteration with a
+// response. The output of other hooks is never parsed, so printing JSON, say
+// from an API call, cannot fail them.
+func respondsTo(hookType HookType) bool {
+	return hookType == HookOnIteration || hookType == HookAfterIteration
+}
+
 // Runner executes hooks
 type Runner struct {
-	OnStart     []string
-	OnIteration []string
-	OnComplete  []string
-	OnFailure   []string
-	Enabled     bool
-	Verbose     bool
+	Hooks   map[HookType][]Hook
+	Enabled bool
+	Verbose bool
 }
 
 // New creates a new hook runner
 func New(enabled bool) *Runner {
 	return &Runner{
+		Hooks:   make(map[HookType][]Hook),
 		Enabled: enabled,
 	}
 }
 
-// SetHooks sets hooks from config
-func (r *Runner) SetHooks(onStart, onIteration, onComplete, onFailure []string) {
-	r.OnStart = onStart
-	r.OnIteration = onIteration
-	r.OnComplete = onComplete
-	r.OnFailure = onFailure
+// SetHooks sets the hooks of one type from config
+func (r *Runner) SetHooks(hookType HookType, hooks []Hook) {
+	r.Hooks[hookType] = hooks
 }
 
-// Run executes hooks of the given type
-func (r *Runner) Run(ctx context.Context, hookType HookType, env map[string]string) error {
+// Run executes hooks of the given type in order, with env added to the
+// environment. It stops at the first hook that fails without continueOnError
+// and returns the results of the hooks run so far.
+func (r *Runner) Run(ctx context.Context, hookType HookType, env map[string]string) ([]Result, error) {
 	if !r.Enabled {
-		return nil
-	}
-
-	var hooks []string
-	switch hookType {
-	case HookOnStart:
-		hooks = r.OnStart
-	case HookOnIteration:
-		hooks = r.OnIteration
-	case HookOnComplete:
-		hooks = r.OnComplete
-	case HookOnFailure:
-		hooks = r.OnFailure
-	default:
-		return fmt.Errorf("unknown hook type: %s", hookType)
+		return nil, nil
+	}
+	if !knownType(hookType) {
+		return nil, fmt.Errorf("unknown hook type: %s", hookType)
 	}
 
-	for _, hook := range hooks {
-		if err := r.runSingle(ctx, hook, env); err != nil {
-			return fmt.Errorf("hook %s failed: %w", hook, err)
+	vars := make(map[string]string, len(env)+1)
+	for k, v := range env {
+		vars[k] = v
+	}
+	vars[EnvHook] = string(hookType)
+
+	var results []Result
+	for _, hook := range r.Hooks[hookType] {
+		if hook.Run == "" {
+			continue
+		}
+
+		result, err := r.runSingle(ctx, hookType, hook, vars)
+		if err != nil && hook.ContinueOnError && ctx.Err() == nil {
+			result.Ignored = true
+			color.Yellow("⚠ %s hook %q failed, continuing: %v", hookType, hook.Run, err)
+			err = nil
+		}
+		results = append(results, result)
+		if err != nil {
+			return results, fmt.Errorf("%s hook %q failed: %w", hookType, hook.Run, err)
 		}
 	}
 
-	return nil
+	return results, nil
 }
 
-// runSingle executes a single hook command
-func (r *Runner) runSingle(ctx context.Context, command string, env map[string]string) error {
-	if command == "" {
-		return nil
+func knownType(hookType HookType) bool {
+	for _, t := range Types {
+		if t == hookType {
+			return true
+		}
 	}
+	return false
+}
 
+// runSingle executes a single hook command, streaming its output and keeping
+// the end of it in the result
+func (r *Runner) runSingle(ctx context.Context, hookType HookType, hook Hook, env map[string]string) (Result, error) {
 	if r.Verbose {
-		fmt.Printf("  Running hook: %s\n", command)
+		fmt.Printf("  Running hook: %s\n", hook.Run)
 	}
 
-	// Parse command
-	parts := strings.Fields(command)
-	if len(parts) == 0 {
-		return nil
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+		defer cancel()
 	}
 
-	cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// out keeps both streams, which are copied concurrently
+	var out, stdout bytes.Buffer
+	combined := shell.NewSyncWriter(&out)
+	cmd := shell.Command(ctx, hook.Run)
+	cmd.Dir = hook.Dir
+	cmd.Stdout = io.MultiWriter(os.Stdout, combined, &stdout)
+	cmd.Stderr = io.MultiWriter(os.Stderr, combined)
+	release := procgroup.Configure(cmd, 5*time.Second)
 
-	// Set environment variables
+	// Set environment variables; the hook's own env wins over Ralph's
 	cmd.Env = os.Environ()
 	for k, v := range env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
+	cmd.Env = append(cmd.Env, hook.Env...)
+
+	started := time.Now()
+	err := cmd.Run()
+	release()
+	result := Result{
+		Hook:     hookType,
+		Command:  hook.Run,
+		Duration: time.Since(started),
+		Output:   shell.Tail(out.String(), maxOutput),
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.ExitCode = -1
+		err = fmt.Errorf("timed out after %s", hook.Timeout)
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		result.ExitCode = -1
+	}
+	if err == nil && respondsTo(hookType) {
+		result.Response, err = parseResponse(stdout.String())
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, err
+}
 
-	return cmd.Run()
+// Outcome describes a finished iteration for afterIteration hooks
+type Outcome struct {
+	ExitCode   int
+	Duration   time.Duration
+	Status     string
+	PRDChanged bool
 }
 
 // RunOnStart runs onStart hooks
-func (r *Runner) RunOnStart(ctx context.Context, iteration int, storyID string) error {
-	return r.Run(ctx, HookOnStart, map[string]string{
-		"RALPH_ITERATION": fmt.Sprintf("%d", iteration),
-		"RALPH_STORY_ID":  storyID,
-		"RALPH_HOOK":      string(HookOnStart),
-	})
+func (r *Runner) RunOnStart(ctx context.Context, env map[string]string) ([]Result, error) {
+	return r.Run(ctx, HookOnStart, env)
 }
 
 // RunOnIteration runs onIteration hooks
-func (r *Runner) RunOnIteration(ctx context.Context, iteration int, storyID string) error {
-	return r.Run(ctx, HookOnIteration, map[string]string{
-		"RALPH_ITERATION": fmt.Sprintf("%d", iteration),
-		"RALPH_STORY_ID":  storyID,
-		"RALPH_HOOK":      string(HookOnIteration),
-	})
+func (r *Runner) RunOnIteration(ctx context.Context, env map[string]string) ([]Result, error) {
+	return r.Run(ctx, HookOnIteration, env)
+}
+
+// RunAfterIteration runs afterIteration hooks
+func (r *Runner) RunAfterIteration(ctx context.Context, env map[string]string, o Outcome) ([]Result, error) {
+	return r.Run(ctx, HookAfterIteration, with(env,
+		EnvExitCode, strconv.Itoa(o.ExitCode),
+		EnvDuration, strconv.Itoa(int(o.Duration.Seconds())),
+		EnvStatus, o.Status,
+		EnvPRDChanged, strconv.FormatBool(o.PRDChanged),
+	))
+}
+
+// RunOnStoryComplete runs onStoryComplete hooks for the story in env
+func (r *Runner) RunOnStoryComplete(ctx context.Context, env map[string]string) ([]Result, error) {
+	return r.Run(ctx, HookOnStoryComplete, env)
+}
+
+// RunOnStoryFailed runs onStoryFailed hooks for the story in env
+func (r *Runner) RunOnStoryFailed(ctx context.Context, env map[string]string, reason string) ([]Result, error) {
+	return r.Run(ctx, HookOnStoryFailed, with(env, EnvFailureReason, reason))
 }
 
 // RunOnComplete runs onComplete hooks
-func (r *Runner) RunOnComplete(ctx context.Context, iterations int, storiesCompleted int) error {
-	return r.Run(ctx, HookOnComplete, map[string]string{
-		"RALPH_ITERATIONS":        fmt.Sprintf("%d", iterations),
-		"RALPH_STORIES_COMPLETED": fmt.Sprintf("%d", storiesCompleted),
-		"RALPH_HOOK":              string(HookOnComplete),
-	})
+func (r *Runner) RunOnComplete(ctx context.Context, env map[string]string, iterations int, storiesCompleted int) ([]Result, error) {
+	return r.Run(ctx, HookOnComplete, with(env,
+		EnvIterations, strconv.Itoa(iterations),
+		EnvStoriesCompleted, strconv.Itoa(storiesCompleted),
+	))
 }
 
 // RunOnFailure runs onFailure hooks
-func (r *Runner) RunOnFailure(ctx context.Context, iteration int, reason string) error {
-	return r.Run(ctx, HookOnFailure, map[string]string{
-		"RALPH_ITERATION":      fmt.Sprintf("%d", iteration),
-		"RALPH_FAILURE_REASON": reason,
-		"RALPH_HOOK":           string(HookOnFailure),
-	})
+func (r *Runner) RunOnFailure(ctx context.Context, env map[string]string, reason string) ([]Result, error) {
+	return r.Run(ctx, HookOnFailure, with(env, EnvFailureReason, reason))
+}
+
+// RunOnStop runs onStop hooks
+func (r *Runner) RunOnStop(ctx context.Context, env map[string]string) ([]Result, error) {
+	return r.Run(ctx, HookOnStop, env)
+}
+
+// with returns a copy of env with the given key/value pairs set
+func with(env map[string]string, kv ...string) map[string]string {
+	vars := make(map[string]string, len(env)+len(kv)/2)
+	for k, v := range env {
+		vars[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		vars[kv[i]] = kv[i+1]
+	}
+	return vars
 }
 
 // HasHooks returns true if any hooks are configured
 func (r *Runner) HasHooks() bool {
-	return len(r.OnStart) > 0 ||
-		len(r.OnIteration) > 0 ||
-		len(r.OnComplete) > 0 ||
-		len(r.OnFailure) > 0
+	for _, hooks := range r.Hooks {
+		if len(hooks) > 0 {
+			return true
+		}
+	}
+	return false
 }
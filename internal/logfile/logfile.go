@@ -0,0 +1,106 @@
+// Package logfile writes a log that rotates once it grows past a size limit:
+// ralph.log is renamed to ralph.log.1, ralph.log.1 to ralph.log.2, and so on,
+// keeping a fixed number of old files.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Defaults for detached runs
+const (
+	DefaultMaxBytes = 10 * 1024 * 1024
+	DefaultKeep     = 3
+)
+
+// Writer appends to a log file, rotating it before a write would take it past
+// MaxBytes
+type Writer struct {
+	Path     string
+	MaxBytes int64 // rotate past this size (0 = never)
+	Keep     int   // rotated files to keep
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens path for appending, creating it if needed
+func Open(path string, maxBytes int64, keep int) (*Writer, error) {
+	w := &Writer{Path: path, MaxBytes: maxBytes, Keep: keep}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write appends p, rotating the file first if it would grow too large
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.MaxBytes > 0 && w.size > 0 && w.size+int64(len(p)) > w.MaxBytes {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// rotate shifts the old files up by one, dropping the oldest, and starts a
+// new file
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	if w.Keep > 0 {
+		_ = os.Remove(fmt.Sprintf("%s.%d", w.Path, w.Keep))
+		for i := w.Keep - 1; i >= 1; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", w.Path, i), fmt.Sprintf("%s.%d", w.Path, i+1))
+		}
+		if err := os.Rename(w.Path, w.Path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	} else if err := os.Truncate(w.Path, 0); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	return w.open()
+}
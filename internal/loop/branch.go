@@ -0,0 +1,81 @@
+package loop
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/git"
+)
+
+// PrepareBranch checks out PRD.BranchName, creating it from HEAD if it does
+// not exist yet, so every iteration commits to the run's branch. Unless
+// allowDirty is set, it refuses to start while tracked files outside Ralph's
+// own state have uncommitted changes. Outside a git repository, or when the
+// PRD has no branch name, it does nothing.
+func (l *Loop) PrepareBranch(allowDirty bool) error {
+	branch := l.PRD.BranchName
+	if l.repoRoot == "" || branch == "" {
+		return nil
+	}
+
+	if !allowDirty {
+		dirty, err := l.dirtyFiles()
+		if err != nil {
+			return err
+		}
+		if len(dirty) > 0 {
+			return fmt.Errorf("uncommitted changes in %s; commit or stash them, or run with --allow-dirty", summarizeFiles(dirty, 3))
+		}
+	}
+
+	current, err := git.CurrentBranch(l.repoRoot)
+	if err != nil {
+		return fmt.Errorf("failed to determine current branch: %w", err)
+	}
+	if current != branch {
+		if err := git.SwitchBranch(l.repoRoot, branch); err != nil {
+			return fmt.Errorf("failed to switch to %s: %w", branch, err)
+		}
+		color.Cyan("Switched to branch %s", branch)
+	}
+
+	l.branch = branch
+	return nil
+}
+
+// dirtyFiles returns tracked files with uncommitted changes, ignoring Ralph's
+// own state. A repository without commits has nothing to lose and is clean.
+func (l *Loop) dirtyFiles() ([]string, error) {
+	if _, err := git.HeadCommit(l.repoRoot); err != nil {
+		return nil, nil
+	}
+
+	modified, err := git.ModifiedFiles(l.repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirty []string
+	for _, f := range modified {
+		if !l.isRalphFile(f) {
+			dirty = append(dirty, f)
+		}
+	}
+	return dirty, nil
+}
+
+// checkBranch returns an error if the agent left the expected branch in dir
+func (l *Loop) checkBranch(dir, expected string) error {
+	if dir == "" || expected == "" {
+		return nil
+	}
+
+	current, err := git.CurrentBranch(dir)
+	if err != nil {
+		return fmt.Errorf("failed to determine current branch: %w", err)
+	}
+	if current != expected {
+		return fmt.Errorf("agent switched branches: expected %s, now on %s", expected, current)
+	}
+	return nil
+}
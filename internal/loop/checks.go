@@ -0,0 +1,141 @@
+package loop
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/prd"
+	"github.com/kylemclaren/ralph/internal/procgroup"
+	"github.com/kylemclaren/ralph/internal/shell"
+)
+
+// maxCheckOutput bounds how much of a failed check's output is kept for the
+// next prompt; the end of the output is usually the informative part
+const maxCheckOutput = 4000
+
+// checkIteration runs the acceptance checks of every story flipped to passing
+// since before. Stories with a failing check are returned to pending and the
+// failures are kept for the next prompt. It returns the IDs of the rejected
+// stories.
+func (l *Loop) checkIteration(ctx context.Context, dir string, before *prd.PRD) ([]string, error) {
+	after, err := prd.Load(l.Config.Paths.PRD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload PRD: %w", err)
+	}
+
+	var rejected []string
+	for _, s := range after.CompletedStories() {
+		story := &s
+		if prev := before.GetStory(s.ID); prev != nil {
+			if prev.Passes {
+				continue
+			}
+			// Use the checks as they were before the agent could edit them
+			story = prev
+		}
+
+		accepted, err := l.checkStory(ctx, dir, story)
+		if err != nil {
+			return rejected, err
+		}
+		if !accepted {
+			rejected = append(rejected, s.ID)
+		}
+	}
+	return rejected, nil
+}
+
+// checkStory runs the story's acceptance checks in dir. A story that fails a
+// check is returned to pending and its failures are recorded; false is
+// returned in that case.
+func (l *Loop) checkStory(ctx context.Context, dir string, story *prd.UserStory) (bool, error) {
+	checks := story.Checks()
+	if len(checks) == 0 {
+		return true, nil
+	}
+
+	var failures []prd.CheckFailure
+	for _, c := range checks {
+		if f := l.runCheck(ctx, dir, story.ID, c); f != nil {
+			failures = append(failures, *f)
+		}
+	}
+
+	// An interrupted check says nothing about the story
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	if len(failures) == 0 {
+		l.Checks.Clear(story.ID)
+		return true, l.Checks.Save()
+	}
+
+	l.Checks.Set(story.ID, failures)
+	if err := l.Checks.Save(); err != nil {
+		return false, err
+	}
+
+	texts := make([]string, len(failures))
+	for i, f := range failures {
+		texts[i] = f.Criterion
+	}
+	note := fmt.Sprintf("Acceptance check failed: %s; returned to pending.", strings.Join(texts, ", "))
+	if err := l.returnToPending(story.ID, note); err != nil {
+		return false, err
+	}
+
+	color.Yellow("⊘ %s failed %d of %d acceptance checks; returned to pending", story.ID, len(failures), len(checks))
+	return false, nil
+}
+
+// runCheck runs a single check command and returns its failure, or nil if it
+// exited 0
+func (l *Loop) runCheck(ctx context.Context, dir, storyID string, c prd.Criterion) *prd.CheckFailure {
+	if timeout := l.Config.Verify.CheckTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var out bytes.Buffer
+	cmd := shell.Command(ctx, c.Check)
+	cmd.Dir = dir
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	release := procgroup.Configure(cmd, 5*time.Second)
+
+	fmt.Printf("  ⚙ %s: %s\n", storyID, c.Check)
+	err := cmd.Run()
+	release()
+	if err == nil {
+		fmt.Printf("    %s %s\n", color.GreenString("✓"), c.Text)
+		return nil
+	}
+
+	f := &prd.CheckFailure{
+		Criterion: c.Text,
+		Command:   c.Check,
+		ExitCode:  -1,
+		Output:    shell.Tail(out.String(), maxCheckOutput),
+		At:        time.Now(),
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		f.Error = fmt.Sprintf("timed out after %s", l.Config.Verify.CheckTimeout)
+	case errors.As(err, &exitErr):
+		f.ExitCode = exitErr.ExitCode()
+	default:
+		f.Error = err.Error()
+	}
+
+	fmt.Printf("    %s %s (exit %d)\n", color.RedString("✗"), c.Text, f.ExitCode)
+	return f
+}
@@ -0,0 +1,152 @@
+package loop
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/agent"
+	"github.com/kylemclaren/ralph/internal/config"
+	"github.com/kylemclaren/ralph/internal/progress"
+	"github.com/kylemclaren/ralph/internal/prompt"
+)
+
+// summarizePrompt asks an agent to fold progress log entries into a summary
+const summarizePrompt = `You are compacting the progress log of an autonomous coding loop. Later
+iterations read the summary instead of the entries below, so keep everything a
+developer continuing the work would need: what each story did, decisions that
+were made, and every learning or gotcha. Leave out file lists and details that
+can be recovered from the code.
+
+Do not run any tools or modify any files. Reply with the summary only, as a
+Markdown bullet list with one bullet per story, without a heading.
+{{with .Previous}}
+## Existing Summary
+
+{{.}}
+{{end}}
+## Entries to Fold In
+
+{{range .Entries}}{{.Text}}
+{{end}}`
+
+var summarizeTemplate = template.Must(template.New("summarize").Parse(summarizePrompt))
+
+// CompactResult describes a progress log compaction
+type CompactResult struct {
+	Folded      int          // entries folded into the summary
+	BytesBefore int          // size of the log before compacting
+	BytesAfter  int          // size of the log after compacting
+	Archive     string       // path the raw log was archived to
+	Usage       *agent.Usage // spent by the agent writing the summary, if it reported any
+}
+
+// CompactProgress archives the progress log and folds all but its last keep
+// entries into a summary. The summary is written by ag if it is not nil, or by
+// progress.Summarize otherwise. With nothing to fold, Folded is 0 and neither
+// the log nor the archive is written. If compacting fails after the agent ran,
+// the result is returned with the error so the usage it spent is not lost.
+func CompactProgress(ctx context.Context, cfg *config.Config, keep int, ag *agent.Agent) (*CompactResult, error) {
+	prog, err := progress.Load(cfg.Paths.Progress)
+	if err != nil {
+		return nil, err
+	}
+	raw := &progress.Progress{Path: prog.Path, Content: prog.Content}
+
+	result := &CompactResult{BytesBefore: len(raw.Content)}
+	summarize := progress.Summarize
+	if ag != nil {
+		summarize = agentSummarizer(ctx, ag, result)
+	}
+
+	if result.Folded, err = prog.Compact(keep, summarize); err != nil {
+		return result, err
+	}
+	result.BytesAfter = len(prog.Content)
+	if result.Folded == 0 {
+		return result, nil
+	}
+	if result.Archive, err = raw.Archive(cfg.Paths.Archive); err != nil {
+		return result, err
+	}
+	if err := prog.Save(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// agentSummarizer returns a progress.Summarizer that has ag write the summary,
+// recording its usage in result
+func agentSummarizer(ctx context.Context, ag *agent.Agent, result *CompactResult) progress.Summarizer {
+	return func(previous string, entries []progress.Entry) (string, error) {
+		var rendered strings.Builder
+		err := summarizeTemplate.Execute(&rendered, struct {
+			Previous string
+			Entries  []progress.Entry
+		}{previous, entries})
+		if err != nil {
+			return "", fmt.Errorf("failed to render summary prompt: %w", err)
+		}
+
+		agentResult, err := ag.Execute(ctx, rendered.String())
+		if err != nil {
+			return "", err
+		}
+		result.Usage = agentResult.Usage
+		if agentResult.Error != nil {
+			return "", fmt.Errorf("agent failed to summarize the progress log: %w", agentResult.Error)
+		}
+		if agentResult.ExitCode != 0 {
+			return "", fmt.Errorf("agent failed to summarize the progress log (exit %d)", agentResult.ExitCode)
+		}
+
+		summary := strings.TrimSpace(agentResult.Final)
+		if summary == "" {
+			return "", fmt.Errorf("agent returned an empty summary")
+		}
+		return summary, nil
+	}
+}
+
+// compactProgress compacts the progress log once it outgrows
+// progress.maxBytes. Compaction is housekeeping, so a failure only warns.
+func (l *Loop) compactProgress(ctx context.Context) {
+	max := l.Config.Progress.MaxBytes
+	if max <= 0 {
+		return
+	}
+	prog, err := progress.Load(l.Config.Paths.Progress)
+	if err != nil || len(prog.Content) <= max {
+		return
+	}
+
+	var ag *agent.Agent
+	if l.Config.Progress.UseAgent {
+		ag = l.Agent.Clone()
+		ag.Output = io.Discard
+		ag.Tap = nil // not an iteration's output for the dashboard
+		ag.PromptFile = ""
+		fmt.Println(color.HiBlackString("Summarizing the progress log with %s...", ag.Name()))
+	}
+
+	result, err := CompactProgress(ctx, l.Config, l.Config.Progress.KeepEntries, ag)
+	if result != nil {
+		l.Usage.Add(result.Usage)
+	}
+	if err != nil && ag != nil && ctx.Err() == nil {
+		color.Yellow("⚠ %v; using the built-in summary", err)
+		result, err = CompactProgress(ctx, l.Config, l.Config.Progress.KeepEntries, nil)
+	}
+	if err != nil {
+		color.Yellow("⚠ Failed to compact the progress log: %v", err)
+		return
+	}
+	if result.Folded > 0 {
+		fmt.Printf("%s Compacted the progress log: folded %d entries (%s → %s), raw log archived to %s\n",
+			color.CyanString("⊙"), result.Folded,
+			prompt.FormatSize(result.BytesBefore), prompt.FormatSize(result.BytesAfter), result.Archive)
+	}
+}
@@ -0,0 +1,137 @@
+package loop
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/prd"
+)
+
+// agentRun is an agent working on a story, which Skip can interrupt
+type agentRun struct {
+	storyID string
+	cancel  context.CancelFunc
+	skipped bool
+}
+
+// Pause makes the loop wait before starting another iteration until Resume is
+// called. Iterations in progress run to completion. It reports whether the
+// loop was running before.
+func (l *Loop) Pause() bool {
+	l.ctlMu.Lock()
+	defer l.ctlMu.Unlock()
+	if l.resumed != nil {
+		return false
+	}
+	l.resumed = make(chan struct{})
+	l.Monitor.SetPaused(true)
+	return true
+}
+
+// Resume lets a paused loop continue. It reports whether the loop was paused.
+func (l *Loop) Resume() bool {
+	l.ctlMu.Lock()
+	defer l.ctlMu.Unlock()
+	if l.resumed == nil {
+		return false
+	}
+	close(l.resumed)
+	l.resumed = nil
+	l.Monitor.SetPaused(false)
+	return true
+}
+
+// Paused reports whether the loop is paused
+func (l *Loop) Paused() bool {
+	l.ctlMu.Lock()
+	defer l.ctlMu.Unlock()
+	return l.resumed != nil
+}
+
+// waitWhilePaused blocks while the loop is paused, until it is resumed, a stop
+// is requested or ctx is done
+func (l *Loop) waitWhilePaused(ctx context.Context) {
+	l.ctlMu.Lock()
+	resumed := l.resumed
+	l.ctlMu.Unlock()
+	if resumed == nil {
+		return
+	}
+
+	color.Yellow("\n⏸  Paused. Run 'ralph resume' to continue.")
+	select {
+	case <-resumed:
+		color.Cyan("▶ Resumed")
+	case <-l.stop:
+	case <-ctx.Done():
+	}
+}
+
+// Skip abandons the story an agent is working on: the agent is interrupted and
+// the story is left alone for the rest of the run. storyID may be empty when
+// only one agent is at work. It returns the ID of the story skipped.
+func (l *Loop) Skip(storyID string) (string, error) {
+	l.ctlMu.Lock()
+	defer l.ctlMu.Unlock()
+
+	var run *agentRun
+	if storyID != "" {
+		if run = l.working[strings.ToUpper(storyID)]; run == nil {
+			return "", fmt.Errorf("no agent is working on %s", storyID)
+		}
+	} else {
+		switch len(l.working) {
+		case 0:
+			return "", fmt.Errorf("no agent is working on a story")
+		case 1:
+			for _, r := range l.working {
+				run = r
+			}
+		default:
+			ids := make([]string, 0, len(l.working))
+			for _, r := range l.working {
+				ids = append(ids, r.storyID)
+			}
+			sort.Strings(ids)
+			return "", fmt.Errorf("agents are working on %s; name the story to skip", strings.Join(ids, ", "))
+		}
+	}
+
+	run.skipped = true
+	run.cancel()
+	return run.storyID, nil
+}
+
+// startAgent registers an agent about to work on storyID. It returns the
+// context to run the agent with, which Skip cancels, and a function to call
+// once the agent is done that reports whether the story was skipped.
+func (l *Loop) startAgent(ctx context.Context, storyID string) (context.Context, func() bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	run := &agentRun{storyID: storyID, cancel: cancel}
+
+	l.ctlMu.Lock()
+	if l.working == nil {
+		l.working = make(map[string]*agentRun)
+	}
+	l.working[strings.ToUpper(storyID)] = run
+	l.ctlMu.Unlock()
+
+	return ctx, func() bool {
+		l.ctlMu.Lock()
+		defer l.ctlMu.Unlock()
+		delete(l.working, strings.ToUpper(storyID))
+		cancel()
+		return run.skipped
+	}
+}
+
+// skipStory records that an iteration's story was skipped with 'ralph skip'
+func (l *Loop) skipStory(result *IterationResult, story *prd.UserStory) {
+	l.skipped[strings.ToUpper(story.ID)] = true
+	result.Status = StatusSkipped
+	result.Message = "skipped with 'ralph skip'"
+	color.Yellow("\n⊘ %s skipped for this run with 'ralph skip'", story.ID)
+}
@@ -0,0 +1,220 @@
+package loop
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/config"
+	"github.com/kylemclaren/ralph/internal/hooks"
+	"github.com/kylemclaren/ralph/internal/notify"
+	"github.com/kylemclaren/ralph/internal/prd"
+)
+
+// newHooks creates the hook runner from config
+func newHooks(cfg config.HooksConfig) *hooks.Runner {
+	r := hooks.New(cfg.Enabled)
+	for _, event := range cfg.Events() {
+		list := make([]hooks.Hook, len(event.Hooks))
+		for i, c := range event.Hooks {
+			list[i] = hooks.Hook{
+				Run:             c.Run,
+				Timeout:         c.Timeout,
+				Dir:             c.Cwd,
+				Env:             c.Env,
+				ContinueOnError: c.ContinueOnError,
+			}
+		}
+		r.SetHooks(hooks.HookType(event.Name), list)
+	}
+	return r
+}
+
+// hookEnv is the environment every hook receives: the Ralph state for story,
+// which may be nil, at the given iteration
+func (l *Loop) hookEnv(story *prd.UserStory, iteration int) map[string]string {
+	return l.ralphEnv(l.PRD, story, iteration, l.PRD.BranchName).ToEnvVars()
+}
+
+// runFailureHooks runs onFailure hooks and sends the failure notification.
+// Like the other hooks reporting on the run, a failing hook only warns.
+func (l *Loop) runFailureHooks(ctx context.Context, reason string) {
+	warnHooks(l.Hooks.RunOnFailure(ctx, l.hookEnv(l.lastStory, l.Iteration), reason))
+	l.sendNotification(notify.EventFailure, l.lastStory, reason)
+}
+
+// runMaxIterationsHooks runs onFailure hooks once the loop used up its
+// iterations and sends the maxIterations notification
+func (l *Loop) runMaxIterationsHooks(ctx context.Context) {
+	const reason = "max iterations reached"
+	warnHooks(l.Hooks.RunOnFailure(ctx, l.hookEnv(l.lastStory, l.Iteration), reason))
+	l.sendNotification(notify.EventMaxIterations, l.lastStory, reason)
+}
+
+// runCompleteHooks runs onComplete hooks and sends the complete notification
+func (l *Loop) runCompleteHooks(ctx context.Context) {
+	warnHooks(l.Hooks.RunOnComplete(ctx, l.hookEnv(l.lastStory, l.Iteration), l.Iteration, l.StoriesComplete))
+	l.sendNotification(notify.EventComplete, nil, "")
+}
+
+// runStopHooks runs onStop hooks once the loop was interrupted or stopped on
+// request. ctx may be cancelled already, so the hooks run without it and are
+// bounded by their timeouts.
+func (l *Loop) runStopHooks(ctx context.Context) {
+	warnHooks(l.Hooks.RunOnStop(context.WithoutCancel(ctx), l.hookEnv(l.lastStory, l.Iteration)))
+}
+
+// iterationStory applies the onIteration hooks' responses to the story chosen
+// for an iteration. It returns the story to work on, or nil if a hook asked to
+// skip it. A story the hooks pick instead must be pending and ready, and not
+// in exclude.
+func (l *Loop) iterationStory(story *prd.UserStory, resp hooks.Response, exclude map[string]bool) *prd.UserStory {
+	if resp.Skip {
+		l.skipped[strings.ToUpper(story.ID)] = true
+		color.Yellow("⊘ %s skipped for this run by an onIteration hook%s", story.ID, because(resp.Reason))
+		return nil
+	}
+	if resp.Story == "" || strings.EqualFold(resp.Story, story.ID) {
+		return story
+	}
+
+	other := l.PRD.GetStory(resp.Story)
+	switch {
+	case other == nil:
+		color.Yellow("⚠ onIteration hook chose story %s, which does not exist; keeping %s", resp.Story, story.ID)
+	case other.Passes || other.Blocked:
+		color.Yellow("⚠ onIteration hook chose story %s, which is passing or blocked; keeping %s", other.ID, story.ID)
+	case !l.PRD.IsReady(other):
+		color.Yellow("⚠ onIteration hook chose story %s, which depends on %s; keeping %s",
+			other.ID, strings.Join(l.PRD.UnmetDependencies(other), ", "), story.ID)
+	case exclude[strings.ToUpper(other.ID)]:
+		color.Yellow("⚠ onIteration hook chose story %s, which is skipped, running or backing off; keeping %s", other.ID, story.ID)
+	default:
+		fmt.Printf("  ↪ onIteration hook switched to %s: %s%s\n", other.ID, other.Title, because(resp.Reason))
+		return other
+	}
+	return story
+}
+
+// runAfterIterationHooks runs afterIteration hooks, keeping their results
+// with the iteration, and returns their merged response. A failing hook fails
+// the iteration.
+func (l *Loop) runAfterIterationHooks(ctx context.Context, story *prd.UserStory, iteration int, outcome hooks.Outcome, result *IterationResult) hooks.Response {
+	if ctx.Err() != nil {
+		return hooks.Response{}
+	}
+
+	results, err := l.Hooks.RunAfterIteration(ctx, l.hookEnv(story, iteration), outcome)
+	result.Hooks = append(result.Hooks, results...)
+	if err != nil && result.Error == nil {
+		result.Error = err
+	}
+	return hooks.Merge(results)
+}
+
+// vetoStories returns stories an afterIteration hook rejected to pending and
+// returns their IDs
+func (l *Loop) vetoStories(stories []prd.UserStory, reason string) ([]string, error) {
+	detail := "rejected by an afterIteration hook" + because(reason)
+	var ids []string
+	for _, s := range stories {
+		note := fmt.Sprintf("Marked as passing but %s; returned to pending.", detail)
+		if err := l.returnToPending(s.ID, note); err != nil {
+			return ids, err
+		}
+		color.Yellow("⊘ %s %s; returned to pending", s.ID, detail)
+		ids = append(ids, s.ID)
+	}
+	return ids, nil
+}
+
+// runStoryHooks runs onStoryComplete and sends the storyComplete notification
+// for each story in completed, and runs onStoryFailed for story if failure is
+// set, keeping the hooks' results with the iteration. They only warn when
+// they fail.
+func (l *Loop) runStoryHooks(ctx context.Context, story *prd.UserStory, iteration int, completed []prd.UserStory, failure string, result *IterationResult) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	for i := range completed {
+		results, err := l.Hooks.RunOnStoryComplete(ctx, l.hookEnv(&completed[i], iteration))
+		result.Hooks = append(result.Hooks, warnHooks(results, err)...)
+		l.sendNotification(notify.EventStoryComplete, &completed[i], "")
+	}
+	if failure != "" {
+		results, err := l.Hooks.RunOnStoryFailed(ctx, l.hookEnv(story, iteration), failure)
+		result.Hooks = append(result.Hooks, warnHooks(results, err)...)
+	}
+}
+
+// vetoed reports whether an afterIteration response rejects the stories
+// marked as passing
+func vetoed(resp hooks.Response) bool {
+	return resp.MarkPassing != nil && !*resp.MarkPassing
+}
+
+// because formats an optional reason, e.g. " (lint failed)"
+func because(reason string) string {
+	if reason == "" {
+		return ""
+	}
+	return " (" + reason + ")"
+}
+
+// warnHooks reports the failure of hooks that must not stop the loop
+func warnHooks(results []hooks.Result, err error) []hooks.Result {
+	if err != nil {
+		color.Yellow("⚠ %v", err)
+	}
+	return results
+}
+
+// completedStories returns the stories passing in after that did not pass in
+// before
+func completedStories(before, after *prd.PRD) []prd.UserStory {
+	if after == nil {
+		return nil
+	}
+	var completed []prd.UserStory
+	for _, s := range after.CompletedStories() {
+		if before != nil {
+			if prev := before.GetStory(s.ID); prev != nil && prev.Passes {
+				continue
+			}
+		}
+		completed = append(completed, s)
+	}
+	return completed
+}
+
+// storyFailure describes why an iteration failed its story, or returns "" if
+// it did not: the agent failed, the story's passing mark was rejected, or the
+// stall policy gave up on it
+func storyFailure(result *IterationResult, rejected bool) string {
+	var reasons []string
+	if (result.Failed() || rejected) && result.Message != "" {
+		reasons = append(reasons, result.Message)
+	}
+	if result.GaveUp != "" && (len(reasons) == 0 || reasons[0] != result.GaveUp) {
+		reasons = append(reasons, result.GaveUp)
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// containsID reports whether ids contains the story ID id
+func containsID(ids []string, id string) bool {
+	for _, v := range ids {
+		if strings.EqualFold(v, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// prdChanged reports whether two PRD snapshots differ
+func prdChanged(before, after *prd.PRD) bool {
+	return !bytes.Equal(prdSnapshot(before), prdSnapshot(after))
+}
@@ -3,16 +3,26 @@ package loop
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/kylemclaren/ralph/internal/agent"
 	"github.com/kylemclaren/ralph/internal/claudecode"
 	"github.com/kylemclaren/ralph/internal/config"
+	"github.com/kylemclaren/ralph/internal/control"
+	"github.com/kylemclaren/ralph/internal/git"
+	"github.com/kylemclaren/ralph/internal/history"
 	"github.com/kylemclaren/ralph/internal/hooks"
+	"github.com/kylemclaren/ralph/internal/monitor"
+	"github.com/kylemclaren/ralph/internal/notify"
+	"github.com/kylemclaren/ralph/internal/pidfile"
 	"github.com/kylemclaren/ralph/internal/prd"
 	"github.com/kylemclaren/ralph/internal/progress"
 	"github.com/kylemclaren/ralph/internal/prompt"
+	"github.com/kylemclaren/ralph/internal/shell"
 )
 
 // Loop manages the Ralph execution loop
@@ -20,14 +30,39 @@ type Loop struct {
 	Config   *config.Config
 	Agent    *agent.Agent
 	Hooks    *hooks.Runner
+	Notifier *notify.Notifier // webhook notifications, nil when disabled
 	PRD      *prd.PRD
 	Progress *progress.Progress
-	Prompt   string
+	Prompt   *prompt.Set
+	History  *history.Run     // run record iterations are written to (optional)
+	Monitor  *monitor.Monitor // live state served by --serve (optional)
 
 	// State
 	Iteration       int
 	StartTime       time.Time
 	StoriesComplete int
+	Attempts        *prd.Attempts
+	Checks          *prd.CheckFailures // failed acceptance checks fed into the next prompt
+	Usage           agent.Usage        // tokens and cost reported by the agent during this run
+	skipped         map[string]bool    // stories skipped by the stall policy for this run
+	repoRoot        string             // repository root, empty outside a git repository
+	branch          string             // branch the run must stay on, set by PrepareBranch
+	ralphFiles      []string           // Ralph's state paths relative to repoRoot
+	lastStory       *prd.UserStory     // story of the latest iteration, for the run's hooks
+	stop            chan struct{}      // closed by RequestStop
+	notifications   *notify.Queue      // sends Notifier's events in the background
+	stopOnce        sync.Once
+
+	// Outcome of earlier iterations shown in the next prompt. Parallel workers
+	// render prompts concurrently, so mu guards them.
+	mu          sync.Mutex
+	previous    string // summary of the last recorded iteration
+	lastFailure string // error and output tail of the last failed iteration
+
+	// Pause and skip requests arrive from other goroutines; ctlMu guards them
+	ctlMu   sync.Mutex
+	resumed chan struct{}        // closed by Resume; nil unless paused
+	working map[string]*agentRun // agents at work, by upper-case story ID
 }
 
 // Result holds the result of a loop execution
@@ -37,38 +72,87 @@ type Result struct {
 	StoriesComplete int
 	Duration        time.Duration
 	Error           error
-	Reason          string // "complete", "max_iterations", "error"
+	Reason          string // "complete", "max_iterations", "failure", "max_retries", "stalled", "blocked", "budget", "error", "stopped", "cancelled"
+}
+
+// NewAgent creates the configured agent and checks that it is installed
+func NewAgent(cfg *config.Config) (*agent.Agent, error) {
+	driver, err := agent.NewDriver(cfg.Agent.Type, agent.DriverOptions{
+		Command:           cfg.Agent.Command,
+		Flags:             cfg.Agent.Flags,
+		PromptMode:        cfg.Agent.PromptMode,
+		CompletionPattern: cfg.Agent.CompletionPattern,
+		Env:               cfg.Agent.Env,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure agent: %w", err)
+	}
+
+	ag := agent.New(driver, cfg.Agent.Timeout)
+	ag.GracePeriod = cfg.Agent.GracePeriod
+
+	// Check agent is available
+	if !ag.Available() {
+		return nil, fmt.Errorf("agent command '%s' not found in PATH", ag.Program())
+	}
+
+	return ag, nil
 }
 
 // New creates a new loop
 func New(cfg *config.Config) (*Loop, error) {
 	// Create agent
-	cmd, args, err := cfg.GetAgentCommand()
+	ag, err := NewAgent(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get agent command: %w", err)
+		return nil, err
 	}
 
-	ag := agent.New(cfg.Agent.Type, cmd, args, cfg.Agent.Timeout)
+	if err := validateStallPolicy(cfg.Loop.StallPolicy); err != nil {
+		return nil, err
+	}
 
-	// Check agent is available
-	if !ag.Available() {
-		return nil, fmt.Errorf("agent command '%s' not found in PATH", cmd)
-	}
-
-	// Create hooks runner
-	hooksRunner := hooks.New(cfg.Hooks.Enabled)
-	hooksRunner.SetHooks(
-		cfg.Hooks.OnStart,
-		cfg.Hooks.OnIteration,
-		cfg.Hooks.OnComplete,
-		cfg.Hooks.OnFailure,
-	)
-
-	return &Loop{
-		Config: cfg,
-		Agent:  ag,
-		Hooks:  hooksRunner,
-	}, nil
+	notifier, err := newNotifier(cfg.Notifications)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Loop{
+		Config:   cfg,
+		Agent:    ag,
+		Hooks:    newHooks(cfg.Hooks),
+		Notifier: notifier,
+		skipped:  make(map[string]bool),
+		stop:     make(chan struct{}),
+	}
+	if notifier != nil {
+		l.notifications = notify.NewQueue(notifier, func(err error) {
+			color.Yellow("⚠ %v", err)
+		})
+	}
+
+	if git.Available() {
+		if root, err := git.Root("."); err == nil {
+			l.repoRoot = root
+		}
+	}
+	if cfg.Verify.Enabled && l.repoRoot == "" {
+		return nil, fmt.Errorf("verify requires a git repository")
+	}
+	if l.repoRoot != "" {
+		l.ralphFiles = ralphPaths(l.repoRoot,
+			cfg.Paths.PRD,
+			cfg.Paths.Progress,
+			prd.AttemptsPath(cfg.Paths.PRD),
+			prd.ChecksPath(cfg.Paths.PRD),
+			cfg.Paths.Runs,
+			cfg.Paths.Archive,
+			filepath.Join(filepath.Dir(cfg.Paths.PRD), "worktrees"),
+			pidfile.DefaultPIDFileName,
+			control.SocketName,
+		)
+	}
+
+	return l, nil
 }
 
 // Load loads the PRD, progress, and prompt files
@@ -81,14 +165,26 @@ func (l *Loop) Load() error {
 		return fmt.Errorf("failed to load PRD: %w", err)
 	}
 
+	// Load per-story attempt counters
+	l.Attempts, err = prd.LoadAttempts(l.Config.Paths.PRD)
+	if err != nil {
+		return fmt.Errorf("failed to load attempts: %w", err)
+	}
+
+	// Load failed acceptance checks from earlier iterations
+	l.Checks, err = prd.LoadCheckFailures(l.Config.Paths.PRD)
+	if err != nil {
+		return fmt.Errorf("failed to load checks: %w", err)
+	}
+
 	// Load progress
 	l.Progress, err = progress.Load(l.Config.Paths.Progress)
 	if err != nil {
 		return fmt.Errorf("failed to load progress: %w", err)
 	}
 
-	// Load prompt template
-	l.Prompt, err = prompt.Load(l.Config.Paths.Prompt)
+	// Load prompt templates
+	l.Prompt, err = prompt.LoadSet(l.Config.Paths.Prompt, l.Config.Paths.Prompts)
 	if err != nil {
 		return fmt.Errorf("failed to load prompt: %w", err)
 	}
@@ -112,37 +208,57 @@ func (l *Loop) Run(ctx context.Context) *Result {
 	}
 
 	// Run onStart hooks
-	nextStory := l.PRD.NextStory()
-	storyID := ""
-	if nextStory != nil {
-		storyID = nextStory.ID
-	}
-
-	if err := l.Hooks.RunOnStart(ctx, 0, storyID); err != nil {
-		result.Error = fmt.Errorf("onStart hook failed: %w", err)
+	if _, err := l.Hooks.RunOnStart(ctx, l.hookEnv(l.PRD.NextStory(), 0)); err != nil {
+		result.Error = err
 		result.Reason = "error"
 		return result
 	}
+	l.sendNotification(notify.EventStart, l.PRD.NextStory(), "")
 
 	// Main loop
+	failures := 0
 	for l.Iteration = 1; l.Iteration <= l.Config.Loop.MaxIterations; l.Iteration++ {
+		// A paused loop waits here, between iterations
+		l.waitWhilePaused(ctx)
+
 		select {
 		case <-ctx.Done():
 			result.Error = ctx.Err()
 			result.Reason = "cancelled"
 			result.Iterations = l.Iteration
+			l.runStopHooks(ctx)
 			return result
 		default:
 		}
 
+		if l.stopRequested() {
+			result.Reason = "stopped"
+			result.Iterations = l.Iteration - 1
+			result.StoriesComplete = l.StoriesComplete
+			result.Duration = time.Since(l.StartTime)
+			l.runStopHooks(ctx)
+
+			color.Yellow("\n⏹  Stopped after iteration %d as requested", l.Iteration-1)
+			return result
+		}
+
 		// Run iteration
 		iterResult := l.runIteration(ctx)
 
+		// An interrupted agent is not a failure of the iteration itself
+		if ctx.Err() != nil {
+			result.Error = ctx.Err()
+			result.Reason = "cancelled"
+			result.Iterations = l.Iteration
+			l.runStopHooks(ctx)
+			return result
+		}
+
 		if iterResult.Error != nil {
 			result.Error = iterResult.Error
 			result.Reason = "error"
 			result.Iterations = l.Iteration
-			_ = l.Hooks.RunOnFailure(ctx, l.Iteration, iterResult.Error.Error())
+			l.runFailureHooks(ctx, iterResult.Error.Error())
 			return result
 		}
 
@@ -153,7 +269,7 @@ func (l *Loop) Run(ctx context.Context) *Result {
 			result.StoriesComplete = l.StoriesComplete
 			result.Duration = time.Since(l.StartTime)
 
-			_ = l.Hooks.RunOnComplete(ctx, l.Iteration, l.StoriesComplete)
+			l.runCompleteHooks(ctx)
 
 			color.Green("\n✅ All stories complete!")
 			fmt.Printf("   Iterations: %d\n", l.Iteration)
@@ -161,26 +277,174 @@ func (l *Loop) Run(ctx context.Context) *Result {
 			return result
 		}
 
+		if exceeded := l.budgetExceeded(); exceeded != "" {
+			result.Reason = "budget"
+			result.Iterations = l.Iteration
+			result.StoriesComplete = l.StoriesComplete
+			result.Duration = time.Since(l.StartTime)
+			l.runFailureHooks(ctx, exceeded)
+
+			color.Yellow("\n⊘ Stopping: %s", exceeded)
+			return result
+		}
+
+		if iterResult.Blocked {
+			result.Reason = "blocked"
+			result.Iterations = l.Iteration - 1
+			result.StoriesComplete = l.StoriesComplete
+			result.Duration = time.Since(l.StartTime)
+			l.runFailureHooks(ctx, "no runnable stories remain")
+
+			color.Yellow("\n⊘ No runnable stories remain (%d blocked, %d skipped)", len(l.PRD.BlockedStories()), len(l.skipped))
+			return result
+		}
+
+		if iterResult.Stalled {
+			result.Reason = "stalled"
+			result.Iterations = l.Iteration
+			result.StoriesComplete = l.StoriesComplete
+			result.Duration = time.Since(l.StartTime)
+			l.runFailureHooks(ctx, iterResult.Message)
+
+			color.Yellow("\n⊘ Stopping: %s", iterResult.Message)
+			return result
+		}
+
+		if iterResult.Failed() {
+			failures++
+			color.Red("\n✗ Iteration %d failed (%s): %s", l.Iteration, iterResult.Status, iterResult.Message)
+
+			stopReason := ""
+			if l.Config.Loop.StopOnFirstFailure {
+				stopReason = "failure"
+			} else if failures > l.Config.Loop.MaxRetries {
+				stopReason = "max_retries"
+			}
+
+			if stopReason != "" {
+				result.Error = fmt.Errorf("iteration %d failed (%s): %s", l.Iteration, iterResult.Status, iterResult.Message)
+				result.Reason = stopReason
+				result.Iterations = l.Iteration
+				result.StoriesComplete = l.StoriesComplete
+				result.Duration = time.Since(l.StartTime)
+				l.runFailureHooks(ctx, result.Error.Error())
+				return result
+			}
+
+			if l.Iteration < l.Config.Loop.MaxIterations {
+				backoff := l.retryBackoff(failures)
+				color.Yellow("   Retrying %s in %v (attempt %d/%d)", iterResult.StoryID, backoff, failures, l.Config.Loop.MaxRetries)
+				l.sleep(ctx, backoff)
+			}
+			continue
+		}
+
+		failures = 0
+
 		// Sleep between iterations
 		if l.Iteration < l.Config.Loop.MaxIterations {
-			time.Sleep(l.Config.Loop.SleepBetween)
+			l.sleep(ctx, l.Config.Loop.SleepBetween)
 		}
 	}
 
 	// Max iterations reached
 	result.Reason = "max_iterations"
 	result.Iterations = l.Iteration - 1
+	result.StoriesComplete = l.StoriesComplete
 	result.Duration = time.Since(l.StartTime)
-	_ = l.Hooks.RunOnFailure(ctx, l.Iteration, "max iterations reached")
+	l.runMaxIterationsHooks(ctx)
 
 	color.Yellow("\n⚠️  Max iterations reached (%d)", l.Config.Loop.MaxIterations)
 	return result
 }
 
+// budgetExceeded returns why the run has used up its cost or token budget, or
+// "" while it is within budget
+func (l *Loop) budgetExceeded() string {
+	if maxCost := l.Config.Loop.MaxCostUSD; maxCost > 0 && l.Usage.CostUSD >= maxCost {
+		return fmt.Sprintf("cost budget reached ($%.2f of $%.2f)", l.Usage.CostUSD, maxCost)
+	}
+	if maxTokens := l.Config.Loop.MaxTokens; maxTokens > 0 && l.Usage.Tokens() >= maxTokens {
+		return fmt.Sprintf("token budget reached (%s of %s tokens)",
+			agent.FormatTokens(l.Usage.Tokens()), agent.FormatTokens(maxTokens))
+	}
+	return ""
+}
+
+// retryBackoff returns the delay before retrying after the given number of
+// consecutive failures, doubling from RetryBackoff up to MaxBackoff
+func (l *Loop) retryBackoff(failures int) time.Duration {
+	backoff := l.Config.Loop.RetryBackoff
+	maxBackoff := l.Config.Loop.MaxBackoff
+	for i := 1; i < failures && (maxBackoff <= 0 || backoff < maxBackoff); i++ {
+		backoff *= 2
+	}
+	if maxBackoff > 0 && backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// RequestStop asks the loop to stop once the iterations in progress have
+// finished, without interrupting the agent. It is safe to call more than once
+// and from another goroutine.
+func (l *Loop) RequestStop() {
+	l.stopOnce.Do(func() { close(l.stop) })
+}
+
+// stopRequested reports whether RequestStop was called
+func (l *Loop) stopRequested() bool {
+	select {
+	case <-l.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for the given duration, until the context is cancelled or until
+// a stop is requested
+func (l *Loop) sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-l.stop:
+	case <-timer.C:
+	}
+}
+
+// IterationStatus classifies the outcome of a single iteration
+type IterationStatus string
+
+const (
+	StatusSuccess    IterationStatus = "success"     // agent exited cleanly and a story was completed
+	StatusAgentError IterationStatus = "agent_error" // agent crashed, exited non-zero, or could not be started
+	StatusTimeout    IterationStatus = "timeout"     // agent exceeded agent.timeout
+	StatusNoProgress IterationStatus = "no_progress" // agent exited cleanly but no story was completed
+	StatusSkipped    IterationStatus = "skipped"     // an onIteration hook skipped the story; the agent did not run
+)
+
 // IterationResult holds the result of a single iteration
 type IterationResult struct {
-	Complete bool
-	Error    error
+	Complete    bool
+	Blocked     bool // no runnable stories remain (all pending stories are blocked or skipped)
+	Stalled     bool // the stall policy asked the loop to stop
+	Status      IterationStatus
+	Message     string // human-readable detail for failed iterations
+	StoryID     string
+	AgentResult *agent.Result
+	GaveUp      string         // why the stall policy gave up on the story, if it did
+	Hooks       []hooks.Result // hooks run for the iteration, with their output
+	Error       error
+}
+
+// Failed returns true if the agent itself failed (crashed or timed out)
+func (r *IterationResult) Failed() bool {
+	return r.Status == StatusAgentError || r.Status == StatusTimeout
 }
 
 // runIteration runs a single loop iteration
@@ -202,9 +466,13 @@ func (l *Loop) runIteration(ctx context.Context) *IterationResult {
 	}
 
 	// Get next story
-	nextStory := l.PRD.NextStory()
+	nextStory := l.PRD.NextStoryExcluding(l.skipped)
 	if nextStory == nil {
-		result.Complete = true
+		if len(l.PRD.PendingStories()) == 0 {
+			result.Complete = true
+		} else {
+			result.Blocked = true
+		}
 		return result
 	}
 
@@ -218,78 +486,403 @@ func (l *Loop) runIteration(ctx context.Context) *IterationResult {
 	fmt.Printf("  📋 %s: %s\n", nextStory.ID, nextStory.Title)
 	fmt.Println()
 
-	// Run onIteration hooks
-	if err := l.Hooks.RunOnIteration(ctx, l.Iteration, nextStory.ID); err != nil {
-		result.Error = fmt.Errorf("onIteration hook failed: %w", err)
+	// Run onIteration hooks, which may skip the story, pick another one or add
+	// to the prompt
+	before := l.PRD
+	l.lastStory = nextStory
+	started := time.Now()
+	result.Hooks, err = l.Hooks.RunOnIteration(ctx, l.hookEnv(nextStory, l.Iteration))
+	if err != nil {
+		result.Error = err
+		l.recordIteration(l.Iteration, nextStory, l.PRD.BranchName, started, result, before)
 		return result
 	}
+	resp := hooks.Merge(result.Hooks)
+	story := l.iterationStory(nextStory, resp, l.skipped)
+	if story == nil {
+		result.StoryID = nextStory.ID
+		result.Status = StatusSkipped
+		result.Message = "skipped by an onIteration hook" + because(resp.Reason)
+		l.recordIteration(l.Iteration, nextStory, l.PRD.BranchName, started, result, before)
+		return result
+	}
+	nextStory = story
+	l.lastStory = nextStory
+	l.Monitor.IterationStarted(l.Iteration, nextStory)
 
-	// Reload progress
+	// Reload progress, compacting it first if it has grown too large
+	l.compactProgress(ctx)
 	l.Progress, err = progress.Load(l.Config.Paths.Progress)
 	if err != nil {
 		result.Error = fmt.Errorf("failed to reload progress: %w", err)
+		l.recordIteration(l.Iteration, nextStory, l.PRD.BranchName, started, result, before)
 		return result
 	}
 
 	// Build prompt
-	templateData, err := prompt.BuildTemplateData(l.PRD, l.Progress)
+	renderedPrompt, err := l.buildPrompt(l.PRD, l.Progress, nextStory, l.PRD.BranchName, l.Iteration, resp.ExtraPrompt)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to build template data: %w", err)
-		return result
-	}
-
-	renderedPrompt, err := prompt.Render(l.Prompt, templateData)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to render prompt: %w", err)
+		result.Error = err
+		l.recordIteration(l.Iteration, nextStory, l.PRD.BranchName, started, result, before)
 		return result
 	}
 
 	// Set Ralph environment variables for the agent
 	// This allows Claude Code hooks (and other agents) to access Ralph state
-	ralphEnv := &claudecode.RalphEnv{
-		Active:         true,
-		Iteration:      l.Iteration,
-		MaxIterations:  l.Config.Loop.MaxIterations,
-		StoryID:        nextStory.ID,
-		StoryTitle:     nextStory.Title,
-		Branch:         l.PRD.BranchName,
-		PRDPath:        l.Config.Paths.PRD,
-		ProgressPath:   l.Config.Paths.Progress,
-		PromptPath:     l.Config.Paths.Prompt,
-		TotalStories:   total,
-		DoneStories:    completed,
-		PendingStories: pending,
-		AgentType:      l.Config.Agent.Type,
+	l.Agent.SetEnv(l.ralphEnv(l.PRD, nextStory, l.Iteration, l.PRD.BranchName).ToEnvVars())
+
+	// Keep the prompt with the run record
+	if l.History != nil {
+		if l.Agent.PromptFile, err = l.History.PromptPath(l.Iteration); err != nil {
+			result.Error = err
+			l.recordIteration(l.Iteration, nextStory, l.PRD.BranchName, started, result, before)
+			return result
+		}
 	}
-	l.Agent.SetEnv(ralphEnv.ToEnvVars())
 
 	// Execute agent
-	agentResult, err := l.Agent.Execute(ctx, renderedPrompt)
+	base := l.verifyBase()
+	flush := l.tapOutput(l.Agent, l.Iteration, nextStory.ID)
+	agentCtx, agentDone := l.startAgent(ctx, nextStory.ID)
+	agentResult, err := l.Agent.Execute(agentCtx, renderedPrompt)
+	skipped := agentDone()
+	flush()
 	if err != nil {
 		result.Error = fmt.Errorf("agent execution failed: %w", err)
+		l.recordIteration(l.Iteration, nextStory, l.PRD.BranchName, started, result, before)
+		return result
+	}
+	result.StoryID = nextStory.ID
+	result.AgentResult = agentResult
+	l.Usage.Add(agentResult.Usage)
+
+	if skipped {
+		l.skipStory(result, nextStory)
+		l.recordIteration(l.Iteration, nextStory, l.PRD.BranchName, started, result, before)
+		return result
+	}
+
+	// Commits on another branch would be lost to the run
+	if err := l.checkBranch(l.repoRoot, l.branch); err != nil {
+		result.Error = err
+		l.recordIteration(l.Iteration, nextStory, l.PRD.BranchName, started, result, l.PRD)
+		return result
+	}
+
+	// Return stories marked as passing without a matching commit to pending
+	rejected, err := l.verifyIteration(base, l.PRD)
+	if err != nil {
+		result.Error = fmt.Errorf("verification failed: %w", err)
+		l.recordIteration(l.Iteration, nextStory, l.PRD.BranchName, started, result, before)
+		return result
+	}
+
+	// Run acceptance checks of the remaining newly passing stories
+	failedChecks, err := l.checkIteration(ctx, ".", l.PRD)
+	if err != nil {
+		result.Error = fmt.Errorf("acceptance checks failed: %w", err)
+		l.recordIteration(l.Iteration, nextStory, l.PRD.BranchName, started, result, before)
 		return result
 	}
+	rejected = append(rejected, failedChecks...)
+
+	storiesComplete := l.StoriesComplete
+	newPRD = l.settleIteration(result, agentResult, rejected, completed, pending)
+
+	// afterIteration hooks may reject the stories the iteration marked as passing
+	outcome := hooks.Outcome{
+		ExitCode:   agentResult.ExitCode,
+		Duration:   agentResult.Duration,
+		Status:     string(result.Status),
+		PRDChanged: prdChanged(before, newPRD),
+	}
+	resp = l.runAfterIterationHooks(ctx, nextStory, l.Iteration, outcome, result)
+	if newlyPassing := completedStories(before, newPRD); vetoed(resp) && len(newlyPassing) > 0 {
+		vetoedIDs, err := l.vetoStories(newlyPassing, resp.Reason)
+		if err != nil && result.Error == nil {
+			result.Error = fmt.Errorf("failed to return stories to pending: %w", err)
+		}
+		rejected = append(rejected, vetoedIDs...)
+		l.StoriesComplete = storiesComplete
+		newPRD = l.settleIteration(result, agentResult, rejected, completed, pending)
+		if result.Status == StatusNoProgress {
+			result.Message = fmt.Sprintf("%s marked as passing but rejected by an afterIteration hook%s",
+				strings.Join(vetoedIDs, ", "), because(resp.Reason))
+		}
+	}
 
+	if !result.Complete {
+		if err := l.trackAttempts(result, newPRD); err != nil {
+			result.Error = err
+		}
+	}
+
+	l.runStoryHooks(ctx, nextStory, l.Iteration, completedStories(before, newPRD),
+		storyFailure(result, containsID(rejected, nextStory.ID)), result)
+
+	l.recordIteration(l.Iteration, nextStory, l.PRD.BranchName, started, result, before)
+
+	return result
+}
+
+// settleIteration sets an iteration's completion and status from the agent
+// result and the stories rejected since it ran, updating the completed count.
+// completed and pending are the story counts before the iteration. It returns
+// the PRD as the iteration left it, or nil if it cannot be read.
+func (l *Loop) settleIteration(result *IterationResult, agentResult *agent.Result, rejected []string, completed, pending int) *prd.PRD {
 	// Check for completion
-	if agentResult.IsComplete {
-		result.Complete = true
+	result.Complete = agentResult.IsComplete && len(rejected) == 0
+	if result.Complete {
 		l.StoriesComplete = completed + pending // All done
 	}
 
 	// Update completed count
-	newPRD, _ = prd.Load(l.Config.Paths.PRD)
+	progressed := false
+	newPRD, _ := prd.Load(l.Config.Paths.PRD)
 	if newPRD != nil {
 		_, newCompleted, _ := newPRD.Stats()
 		if newCompleted > completed {
 			l.StoriesComplete = newCompleted
+			progressed = true
 		}
 	}
 
-	return result
+	classify(result, agentResult, progressed)
+	if result.Status == StatusNoProgress && len(rejected) > 0 {
+		result.Message = fmt.Sprintf("%s marked as passing but failed verification", strings.Join(rejected, ", "))
+	}
+	return newPRD
+}
+
+// recordIteration writes the iteration, its agent output and the PRD before
+// and after it to the run history, if one is attached
+func (l *Loop) recordIteration(n int, story *prd.UserStory, branch string, started time.Time, result *IterationResult, before *prd.PRD) {
+	it := &history.Iteration{
+		Number:     n,
+		StoryID:    story.ID,
+		StoryTitle: story.Title,
+		Branch:     branch,
+		StartedAt:  started,
+		EndedAt:    time.Now(),
+		Status:     string(result.Status),
+		Message:    result.Message,
+		Complete:   result.Complete,
+		Hooks:      result.Hooks,
+	}
+
+	output := ""
+	if ar := result.AgentResult; ar != nil {
+		output = ar.Output
+		it.ExitCode = ar.ExitCode
+		it.TimedOut = ar.TimedOut
+		it.Usage = ar.Usage
+		if ar.Error != nil {
+			it.Error = ar.Error.Error()
+		}
+	}
+	if result.Error != nil {
+		it.Error = result.Error.Error()
+	}
+
+	l.Monitor.IterationFinished(n, it.Status, l.Usage)
+
+	l.mu.Lock()
+	l.previous = iterationSummary(it)
+	if result.Failed() || result.Error != nil {
+		l.lastFailure = failureSummary(it, output)
+	}
+	l.mu.Unlock()
+
+	if l.History == nil {
+		return
+	}
+
+	after, _ := prd.Load(l.Config.Paths.PRD)
+	if err := l.History.RecordIteration(it, output, prdSnapshot(before), prdSnapshot(after)); err != nil {
+		color.Yellow("  Warning: failed to record iteration %d: %v", n, err)
+	}
+}
+
+// iterationSummary describes an iteration's outcome in one line for the next
+// prompt
+func iterationSummary(it *history.Iteration) string {
+	summary := fmt.Sprintf("Iteration %d (%s - %s): %s, exit code %d", it.Number, it.StoryID, it.StoryTitle, it.Status, it.ExitCode)
+	if it.Message != "" {
+		summary += ". " + it.Message
+	}
+	if it.Error != "" {
+		summary += ". Error: " + it.Error
+	}
+	return summary
+}
+
+// failureSummary describes a failed iteration with the end of its output
+func failureSummary(it *history.Iteration, output string) string {
+	summary := fmt.Sprintf("Iteration %d (%s) failed", it.Number, it.StoryID)
+	switch {
+	case it.Error != "":
+		summary += ": " + it.Error
+	case it.ExitCode != 0:
+		summary += fmt.Sprintf(" with exit code %d", it.ExitCode)
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		summary += "\n\n" + shell.Tail(output, maxCheckOutput)
+	}
+	return summary
+}
+
+// prdSnapshot returns the PRD as JSON, or nil if it is unavailable
+func prdSnapshot(p *prd.PRD) []byte {
+	if p == nil {
+		return nil
+	}
+	data, err := p.ToJSON()
+	if err != nil {
+		return nil
+	}
+	return []byte(data)
+}
+
+// classify sets the iteration status from the agent result and PRD progress
+func classify(result *IterationResult, agentResult *agent.Result, progressed bool) {
+	switch {
+	case agentResult.TimedOut:
+		result.Status = StatusTimeout
+		result.Message = agentResult.Error.Error()
+	case agentResult.Error != nil:
+		result.Status = StatusAgentError
+		result.Message = agentResult.Error.Error()
+	case agentResult.ExitCode != 0:
+		result.Status = StatusAgentError
+		result.Message = fmt.Sprintf("agent exited with code %d", agentResult.ExitCode)
+	case progressed || result.Complete:
+		result.Status = StatusSuccess
+	default:
+		result.Status = StatusNoProgress
+		result.Message = "no story was marked as passing"
+	}
+}
+
+// tapOutput sends an agent's output for an iteration to the monitor, if there
+// is one, and returns a function that flushes it once the agent has exited
+func (l *Loop) tapOutput(ag *agent.Agent, iteration int, storyID string) func() {
+	if l.Monitor == nil {
+		ag.Tap = nil
+		return func() {}
+	}
+	w := l.Monitor.Writer(iteration, storyID)
+	ag.Tap = w
+	return func() { _ = w.Close() }
+}
+
+// buildPrompt renders the prompt template for the given story and branch,
+// followed by extra text from onIteration hooks
+func (l *Loop) buildPrompt(p *prd.PRD, prog *progress.Progress, story *prd.UserStory, branch string, iteration int, extra string) (string, error) {
+	templateData, err := prompt.BuildTemplateData(p, prog)
+	if err != nil {
+		return "", fmt.Errorf("failed to build template data: %w", err)
+	}
+
+	templateData.NextStory = story
+	templateData.StoryEntries = prompt.StoryEntries(templateData.Entries, story)
+	templateData.BranchName = branch
+	templateData.Iteration = iteration
+	templateData.MaxIterations = l.Config.Loop.MaxIterations
+	l.mu.Lock()
+	templateData.PreviousIterationSummary = l.previous
+	templateData.LastFailure = l.lastFailure
+	l.mu.Unlock()
+	if l.Checks != nil {
+		templateData.FailedChecks = l.Checks.Get(story.ID)
+	}
+
+	name, err := l.Prompt.TemplateFor(story)
+	if err != nil {
+		return "", err
+	}
+	renderedPrompt, err := l.Prompt.Render(name, templateData)
+	if err != nil {
+		return "", err
+	}
+
+	// Prompts written before acceptance checks existed do not show failures
+	if len(templateData.FailedChecks) > 0 && !strings.Contains(l.Prompt.Source(name), ".FailedChecks") {
+		section, err := prompt.Render(prompt.FailedChecksTemplate, templateData)
+		if err != nil {
+			return "", fmt.Errorf("failed to render failed checks: %w", err)
+		}
+		renderedPrompt += "\n" + section
+	}
+
+	// Text added by onIteration hooks
+	if extra != "" {
+		renderedPrompt += "\n" + extra + "\n"
+	}
+
+	if err := l.checkPromptSize(renderedPrompt, templateData); err != nil {
+		return "", err
+	}
+
+	return renderedPrompt, nil
+}
+
+// checkPromptSize warns about a prompt large enough to crowd the agent's
+// context, naming its largest sections. A prompt too long to pass as a
+// command-line argument is an error for agents that take it that way.
+func (l *Loop) checkPromptSize(rendered string, data prompt.TemplateData) error {
+	size := len(rendered)
+	if size <= prompt.WarnSize {
+		return nil
+	}
+
+	sections := prompt.Sections(rendered, data)
+	names := make([]string, 0, 2)
+	for i := 0; i < len(sections) && i < 2; i++ {
+		names = append(names, sections[i].String())
+	}
+
+	if l.Agent.Driver.PromptMode() == agent.PromptArg && size > prompt.MaxArgSize {
+		return fmt.Errorf("prompt is %s, too large to pass as an argument (largest: %s); set agent.promptMode to stdin or file, or trim it",
+			prompt.FormatSize(size), strings.Join(names, ", "))
+	}
+
+	color.Yellow("⚠ Prompt is %s (largest: %s)", prompt.FormatSize(size), strings.Join(names, ", "))
+	if sections[0].Name == ".Progress" && l.Config.Progress.MaxBytes <= 0 {
+		color.Yellow("  Run 'ralph log compact' or set progress.maxBytes to shrink the progress log")
+	}
+	return nil
+}
+
+// ralphEnv builds the Ralph state exposed to the agent and hooks for the
+// given story, which may be nil
+func (l *Loop) ralphEnv(p *prd.PRD, story *prd.UserStory, iteration int, branch string) *claudecode.RalphEnv {
+	total, completed, pending := p.Stats()
+	env := &claudecode.RalphEnv{
+		Active:         true,
+		Iteration:      iteration,
+		MaxIterations:  l.Config.Loop.MaxIterations,
+		Branch:         branch,
+		PRDPath:        l.Config.Paths.PRD,
+		ProgressPath:   l.Config.Paths.Progress,
+		PromptPath:     l.Config.Paths.Prompt,
+		TotalStories:   total,
+		DoneStories:    completed,
+		PendingStories: pending,
+		AgentType:      l.Config.Agent.Type,
+	}
+	if story != nil {
+		env.StoryID = story.ID
+		env.StoryTitle = story.Title
+	}
+	return env
 }
 
 // RunOnce runs a single iteration (human-in-the-loop mode)
 func (l *Loop) RunOnce(ctx context.Context) *IterationResult {
 	l.Iteration = 1
-	return l.runIteration(ctx)
+	result := l.runIteration(ctx)
+	if ctx.Err() != nil {
+		l.runStopHooks(ctx)
+	}
+	return result
 }
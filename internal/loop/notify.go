@@ -0,0 +1,108 @@
+package loop
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/config"
+	"github.com/kylemclaren/ralph/internal/notify"
+	"github.com/kylemclaren/ralph/internal/prd"
+)
+
+// newNotifier creates the webhook notifier from config, or returns nil when
+// notifications are disabled
+func newNotifier(cfg config.NotificationsConfig) (*notify.Notifier, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.Webhook == "" {
+		return nil, fmt.Errorf("notifications are enabled but notifications.webhook is not set")
+	}
+
+	format, err := notify.ParseFormat(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	n := notify.New(cfg.Webhook)
+	n.Format = format
+	n.Retries = cfg.Retries
+	n.Backoff = cfg.RetryBackoff
+	if cfg.Timeout > 0 {
+		n.Client.Timeout = cfg.Timeout
+	}
+	for _, name := range cfg.Events {
+		t, err := notify.ParseEvent(name)
+		if err != nil {
+			return nil, err
+		}
+		n.Events = append(n.Events, t)
+	}
+	return n, nil
+}
+
+// sendNotification queues an event about the run to be posted to the webhook
+// in the background. story may be nil. A notification that cannot be delivered
+// only warns.
+func (l *Loop) sendNotification(t notify.EventType, story *prd.UserStory, reason string) {
+	if l.Notifier == nil || !l.Notifier.Wants(t) {
+		return
+	}
+
+	// Count stories from the PRD on disk, which parallel merges update
+	p, err := prd.Load(l.Config.Paths.PRD)
+	if err != nil {
+		p = l.PRD
+	}
+	total, completed, _ := p.Stats()
+
+	// The sequential loop ends one past its last iteration
+	iteration := l.Iteration
+	if iteration > l.Config.Loop.MaxIterations {
+		iteration = l.Config.Loop.MaxIterations
+	}
+
+	e := notify.Event{
+		Type:            t,
+		Project:         l.projectName(),
+		Branch:          p.BranchName,
+		Iteration:       iteration,
+		MaxIterations:   l.Config.Loop.MaxIterations,
+		StoriesComplete: completed,
+		StoriesTotal:    total,
+		Reason:          reason,
+		Duration:        time.Since(l.StartTime),
+	}
+	if story != nil {
+		e.StoryID = story.ID
+		e.StoryTitle = story.Title
+	}
+
+	l.notifications.Send(e)
+}
+
+// FlushNotifications waits up to timeout for queued notifications to be sent,
+// so the last events of a run are not lost when ralph exits
+func (l *Loop) FlushNotifications(timeout time.Duration) {
+	if l.notifications == nil {
+		return
+	}
+	if !l.notifications.Close(timeout) {
+		color.Yellow("⚠ Gave up on notifications not sent within %s", timeout)
+	}
+}
+
+// projectName names the project in notifications after the repository, or
+// the working directory outside one
+func (l *Loop) projectName() string {
+	if l.repoRoot != "" {
+		return filepath.Base(l.repoRoot)
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		return filepath.Base(cwd)
+	}
+	return ""
+}
@@ -0,0 +1,769 @@
+package loop
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/agent"
+	"github.com/kylemclaren/ralph/internal/git"
+	"github.com/kylemclaren/ralph/internal/hooks"
+	"github.com/kylemclaren/ralph/internal/notify"
+	"github.com/kylemclaren/ralph/internal/prd"
+	"github.com/kylemclaren/ralph/internal/progress"
+)
+
+// workspace describes the repository layout used by parallel workers
+type workspace struct {
+	root         string // top-level directory of the main checkout
+	worktrees    string // directory holding one worktree per running story
+	prdRel       string // PRD path relative to root
+	progressRel  string // progress path relative to root
+	baseBranch   string // integration branch (PRD.BranchName)
+	dirRel       string // working directory relative to root, where checks run
+	progressPath string // absolute path of the main progress file
+
+	// mu serializes git operations on root and access to the main progress
+	// file between workers setting up and the loop merging their results
+	mu sync.Mutex
+}
+
+// workerResult holds the outcome of one story executed in a worktree
+type workerResult struct {
+	story     prd.UserStory
+	iteration int
+	branch    string
+	worktree  string
+	base      string // commit the worker branch was created from
+	progress  string // progress content copied into the worktree
+	snapshot  *prd.PRD
+	started   time.Time
+	agent     *agent.Result
+	hooks     []hooks.Result // onIteration hooks run before the worker started
+	skipped   bool           // abandoned with 'ralph skip'
+	err       error
+}
+
+// RunParallel executes ready stories concurrently, each with its own agent in
+// a separate git worktree, and merges completed branches into PRD.BranchName.
+// A merge conflict returns the story to pending with a note.
+func (l *Loop) RunParallel(ctx context.Context, workers int) *Result {
+	l.StartTime = time.Now()
+
+	result := &Result{}
+
+	if l.PRD.IsComplete() {
+		result.Success = true
+		result.Reason = "complete"
+		result.Duration = time.Since(l.StartTime)
+		color.Green("All stories already complete!")
+		return result
+	}
+
+	ws, err := l.setupWorkspace()
+	if err != nil {
+		result.Error = err
+		result.Reason = "error"
+		return result
+	}
+
+	if _, err := l.Hooks.RunOnStart(ctx, l.hookEnv(l.PRD.NextStory(), 0)); err != nil {
+		result.Error = err
+		result.Reason = "error"
+		return result
+	}
+	l.sendNotification(notify.EventStart, l.PRD.NextStory(), "")
+
+	results := make(chan *workerResult)
+	running := make(map[string]bool)
+	retryAt := make(map[string]time.Time)
+	failures := 0
+	stopReason := ""
+
+	for {
+		// Launch workers for ready stories while there is capacity
+		if stopReason == "" && ctx.Err() == nil && !l.stopRequested() && !l.Paused() {
+			current, err := prd.Load(l.Config.Paths.PRD)
+			if err != nil {
+				result.Error = fmt.Errorf("failed to reload PRD: %w", err)
+				stopReason = "error"
+			} else {
+				l.PRD = current
+				for len(running) < workers && l.Iteration < l.Config.Loop.MaxIterations {
+					story := current.NextStoryExcluding(l.excludedStories(running, retryAt))
+					if story == nil {
+						break
+					}
+
+					// Workers copy the progress log, so compact it before they start
+					ws.mu.Lock()
+					l.compactProgress(ctx)
+					ws.mu.Unlock()
+
+					l.Iteration++
+					running[strings.ToUpper(story.ID)] = true
+					color.Cyan("▶ Iteration %d/%d | %s: %s", l.Iteration, l.Config.Loop.MaxIterations, story.ID, story.Title)
+
+					started := time.Now()
+					hookResults, err := l.Hooks.RunOnIteration(ctx, l.hookEnv(story, l.Iteration))
+					if err != nil {
+						delete(running, strings.ToUpper(story.ID))
+						result.Error = err
+						stopReason = "error"
+						l.recordIteration(l.Iteration, story, ws.baseBranch, started,
+							&IterationResult{StoryID: story.ID, Hooks: hookResults, Error: result.Error}, current)
+						break
+					}
+
+					resp := hooks.Merge(hookResults)
+					delete(running, strings.ToUpper(story.ID))
+					chosen := l.iterationStory(story, resp, l.excludedStories(running, retryAt))
+					if chosen == nil {
+						l.recordIteration(l.Iteration, story, ws.baseBranch, started, &IterationResult{
+							StoryID: story.ID,
+							Status:  StatusSkipped,
+							Message: "skipped by an onIteration hook" + because(resp.Reason),
+							Hooks:   hookResults,
+						}, current)
+						continue
+					}
+					running[strings.ToUpper(chosen.ID)] = true
+					l.Monitor.IterationStarted(l.Iteration, chosen)
+
+					go func(snapshot *prd.PRD, story prd.UserStory, iteration int, hookResults []hooks.Result, extra string) {
+						wr := l.runWorker(ctx, ws, snapshot, story, iteration, extra)
+						wr.hooks = hookResults
+						results <- wr
+					}(current, *chosen, l.Iteration, hookResults, resp.ExtraPrompt)
+				}
+			}
+		}
+
+		if len(running) == 0 {
+			// A paused loop waits here once its workers are done
+			if stopReason == "" && ctx.Err() == nil && !l.stopRequested() && l.Paused() {
+				l.waitWhilePaused(ctx)
+				continue
+			}
+
+			// Wait for a story that is backing off after a failure
+			if wait := nextRetry(retryAt); stopReason == "" && ctx.Err() == nil && !l.stopRequested() &&
+				wait > 0 && l.Iteration < l.Config.Loop.MaxIterations {
+				l.sleep(ctx, wait)
+				continue
+			}
+			break
+		}
+
+		wr := <-results
+		delete(running, strings.ToUpper(wr.story.ID))
+
+		if wr.agent != nil {
+			l.Usage.Add(wr.agent.Usage)
+		}
+		iterResult := l.finishWorker(ctx, ws, wr)
+		switch {
+		case ctx.Err() != nil:
+			// Interrupted agents are not failures
+		case iterResult.Error != nil:
+			if stopReason == "" {
+				result.Error = iterResult.Error
+				stopReason = "error"
+			}
+		case iterResult.Stalled:
+			if stopReason == "" {
+				color.Yellow("\n⊘ Stopping: %s", iterResult.Message)
+				stopReason = "stalled"
+			}
+		case iterResult.Failed():
+			failures++
+			color.Red("✗ [%s] iteration %d failed (%s): %s", wr.story.ID, wr.iteration, iterResult.Status, iterResult.Message)
+			if stopReason != "" {
+				break
+			}
+			if l.Config.Loop.StopOnFirstFailure {
+				stopReason = "failure"
+			} else if failures > l.Config.Loop.MaxRetries {
+				stopReason = "max_retries"
+			} else {
+				retryAt[strings.ToUpper(wr.story.ID)] = time.Now().Add(l.retryBackoff(failures))
+			}
+			if stopReason != "" {
+				result.Error = fmt.Errorf("iteration %d failed (%s): %s", wr.iteration, iterResult.Status, iterResult.Message)
+			}
+		default:
+			failures = 0
+		}
+
+		if exceeded := l.budgetExceeded(); exceeded != "" && stopReason == "" {
+			color.Yellow("\n⊘ Stopping: %s", exceeded)
+			stopReason = "budget"
+		}
+	}
+
+	result.Iterations = l.Iteration
+	result.StoriesComplete = l.StoriesComplete
+	result.Duration = time.Since(l.StartTime)
+
+	if stopReason != "" {
+		result.Reason = stopReason
+		if result.Error != nil {
+			l.runFailureHooks(ctx, result.Error.Error())
+		} else {
+			l.runFailureHooks(ctx, stopReason)
+		}
+		return result
+	}
+
+	if ctx.Err() != nil {
+		result.Error = ctx.Err()
+		result.Reason = "cancelled"
+		l.runStopHooks(ctx)
+		return result
+	}
+
+	final, err := prd.Load(l.Config.Paths.PRD)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to reload PRD: %w", err)
+		result.Reason = "error"
+		return result
+	}
+	l.PRD = final
+
+	switch {
+	case final.IsComplete():
+		result.Success = true
+		result.Reason = "complete"
+		l.runCompleteHooks(ctx)
+
+		color.Green("\n✅ All stories complete!")
+		fmt.Printf("   Iterations: %d\n", l.Iteration)
+		fmt.Printf("   Duration: %v\n", result.Duration.Round(time.Second))
+	case l.stopRequested():
+		result.Reason = "stopped"
+		l.runStopHooks(ctx)
+
+		color.Yellow("\n⏹  Stopped after %d iterations as requested", l.Iteration)
+	case l.Iteration >= l.Config.Loop.MaxIterations:
+		result.Reason = "max_iterations"
+		l.runMaxIterationsHooks(ctx)
+
+		color.Yellow("\n⚠️  Max iterations reached (%d)", l.Config.Loop.MaxIterations)
+	default:
+		result.Reason = "blocked"
+		l.runFailureHooks(ctx, "no runnable stories remain")
+
+		color.Yellow("\n⊘ No runnable stories remain (%d blocked, %d skipped)", len(final.BlockedStories()), len(l.skipped))
+	}
+
+	return result
+}
+
+// setupWorkspace resolves the repository layout and checks out the
+// integration branch that worker branches are merged into
+func (l *Loop) setupWorkspace() (*workspace, error) {
+	if !git.Available() {
+		return nil, fmt.Errorf("parallel mode requires git")
+	}
+
+	root, err := git.Root(".")
+	if err != nil {
+		return nil, fmt.Errorf("parallel mode requires a git repository: %w", err)
+	}
+
+	ws := &workspace{
+		root:       root,
+		baseBranch: l.PRD.BranchName,
+	}
+	if ws.baseBranch == "" {
+		return nil, fmt.Errorf("parallel mode requires branchName to be set in the PRD")
+	}
+
+	absPRD, err := filepath.Abs(l.Config.Paths.PRD)
+	if err != nil {
+		return nil, err
+	}
+	ws.progressPath, err = filepath.Abs(l.Config.Paths.Progress)
+	if err != nil {
+		return nil, err
+	}
+	ws.prdRel, err = relInside(root, absPRD)
+	if err != nil {
+		return nil, err
+	}
+	ws.progressRel, err = relInside(root, ws.progressPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	ws.dirRel, err = relInside(root, cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	ws.worktrees = filepath.Join(filepath.Dir(absPRD), "worktrees")
+	worktreesRel, err := relInside(root, ws.worktrees)
+	if err != nil {
+		return nil, err
+	}
+	if err := git.Exclude(root, "/"+filepath.ToSlash(worktreesRel)+"/"); err != nil {
+		return nil, fmt.Errorf("failed to exclude worktrees directory: %w", err)
+	}
+
+	current, err := git.CurrentBranch(root)
+	if err != nil {
+		return nil, err
+	}
+	if current != ws.baseBranch {
+		if err := git.SwitchBranch(root, ws.baseBranch); err != nil {
+			return nil, fmt.Errorf("failed to switch to %s: %w", ws.baseBranch, err)
+		}
+	}
+
+	return ws, nil
+}
+
+// runWorker creates a worktree for the story and runs a cloned agent in it.
+// extra is text onIteration hooks added to the prompt.
+func (l *Loop) runWorker(ctx context.Context, ws *workspace, snapshot *prd.PRD, story prd.UserStory, iteration int, extra string) *workerResult {
+	wr := &workerResult{
+		story:     story,
+		iteration: iteration,
+		snapshot:  snapshot,
+		branch:    ws.baseBranch + "-" + strings.ToLower(story.ID),
+		worktree:  filepath.Join(ws.worktrees, strings.ToLower(story.ID)),
+		started:   time.Now(),
+	}
+
+	prog, err := l.createWorktree(ws, wr)
+	if err != nil {
+		wr.err = err
+		return wr
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(wr.worktree, ws.prdRel)), 0755); err != nil {
+		wr.err = err
+		return wr
+	}
+	if err := snapshot.Save(filepath.Join(wr.worktree, ws.prdRel)); err != nil {
+		wr.err = err
+		return wr
+	}
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(wr.worktree, ws.progressRel)), 0755); err != nil {
+		wr.err = err
+		return wr
+	}
+	workerProg := &progress.Progress{Path: filepath.Join(wr.worktree, ws.progressRel), Content: prog.Content}
+	if err := workerProg.Save(); err != nil {
+		wr.err = err
+		return wr
+	}
+
+	renderedPrompt, err := l.buildPrompt(snapshot, prog, &story, wr.branch, iteration, extra)
+	if err != nil {
+		wr.err = err
+		return wr
+	}
+
+	out := newPrefixWriter(os.Stdout, color.CyanString("[%s] ", story.ID))
+	defer out.Flush()
+
+	ag := l.Agent.Clone()
+	ag.Dir = wr.worktree
+	ag.Output = out
+	ag.SetEnv(l.ralphEnv(snapshot, &story, iteration, wr.branch).ToEnvVars())
+	if l.History != nil {
+		if ag.PromptFile, err = l.History.PromptPath(iteration); err != nil {
+			wr.err = err
+			return wr
+		}
+	}
+
+	flush := l.tapOutput(ag, iteration, story.ID)
+	agentCtx, agentDone := l.startAgent(ctx, story.ID)
+	wr.agent, wr.err = ag.Execute(agentCtx, renderedPrompt)
+	wr.skipped = agentDone()
+	flush()
+	return wr
+}
+
+// createWorktree checks out a new worker branch from the integration branch
+// and returns a snapshot of the main progress log. It holds the workspace lock,
+// so no merge or progress update is under way meanwhile.
+func (l *Loop) createWorktree(ws *workspace, wr *workerResult) (*progress.Progress, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	// Clear leftovers from an interrupted earlier run
+	if _, err := os.Stat(wr.worktree); err == nil {
+		_ = git.RemoveWorktree(ws.root, wr.worktree)
+	}
+	if git.BranchExists(ws.root, wr.branch) {
+		_ = git.DeleteBranch(ws.root, wr.branch)
+	}
+
+	base, err := git.HeadCommit(ws.root)
+	if err != nil {
+		return nil, err
+	}
+	wr.base = base
+
+	if err := git.AddWorktree(ws.root, wr.worktree, wr.branch, base); err != nil {
+		return nil, fmt.Errorf("failed to create worktree for %s: %w", wr.story.ID, err)
+	}
+
+	// Give the worker the current Ralph state, which may not be committed
+	prog, err := progress.Load(ws.progressPath)
+	if err != nil {
+		return nil, err
+	}
+	wr.progress = prog.Content
+	return prog, nil
+}
+
+// finishWorker inspects a worker's outcome, merges its branch when the story
+// passed, and records the result in the main PRD and progress log
+func (l *Loop) finishWorker(ctx context.Context, ws *workspace, wr *workerResult) *IterationResult {
+	result := &IterationResult{StoryID: wr.story.ID, AgentResult: wr.agent, Hooks: wr.hooks}
+
+	defer func() {
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+		if _, err := os.Stat(wr.worktree); err == nil {
+			_ = git.RemoveWorktree(ws.root, wr.worktree)
+		}
+		if git.BranchExists(ws.root, wr.branch) {
+			_ = git.DeleteBranch(ws.root, wr.branch)
+		}
+	}()
+
+	// The iteration is recorded however it ends, errors included, so its
+	// output stays in the run history and the dashboard sees it finish
+	defer func() {
+		l.recordIteration(wr.iteration, &wr.story, wr.branch, wr.started, result, wr.snapshot)
+	}()
+
+	if wr.err != nil {
+		result.Error = wr.err
+		return result
+	}
+
+	// The worktree and its branch are discarded with the story's changes
+	if wr.skipped {
+		l.skipStory(result, &wr.story)
+		return result
+	}
+
+	workerPRD, _ := prd.Load(filepath.Join(wr.worktree, ws.prdRel))
+	passed := false
+	if workerPRD != nil {
+		if s := workerPRD.GetStory(wr.story.ID); s != nil {
+			passed = s.Passes
+		}
+	}
+
+	if err := l.checkBranch(wr.worktree, wr.branch); err != nil {
+		result.Error = fmt.Errorf("[%s] %w", wr.story.ID, err)
+		return result
+	}
+
+	var problems []string
+	if passed && l.Config.Verify.Enabled {
+		var err error
+		problems, err = l.verifyStory(wr.worktree, wr.base, wr.story.ID)
+		if err != nil {
+			result.Error = fmt.Errorf("verification failed: %w", err)
+			return result
+		}
+		if len(problems) > 0 {
+			passed = false
+			if err := l.rejectStory(wr.story.ID, problems); err != nil {
+				result.Error = err
+				return result
+			}
+		}
+	}
+
+	if passed {
+		accepted, err := l.checkStory(ctx, filepath.Join(wr.worktree, ws.dirRel), &wr.story)
+		if err != nil {
+			result.Error = fmt.Errorf("acceptance checks failed: %w", err)
+			return result
+		}
+		if !accepted {
+			passed = false
+			problems = append(problems, "failed acceptance checks")
+		}
+	}
+
+	classify(result, wr.agent, passed)
+
+	// afterIteration hooks may reject the story before it is merged
+	l.lastStory = &wr.story
+	outcome := hooks.Outcome{
+		ExitCode:   wr.agent.ExitCode,
+		Duration:   wr.agent.Duration,
+		Status:     string(result.Status),
+		PRDChanged: workerPRD != nil && prdChanged(wr.snapshot, workerPRD),
+	}
+	resp := l.runAfterIterationHooks(ctx, &wr.story, wr.iteration, outcome, result)
+	if result.Error != nil {
+		return result
+	}
+	if passed && vetoed(resp) {
+		if _, err := l.vetoStories([]prd.UserStory{wr.story}, resp.Reason); err != nil {
+			result.Error = fmt.Errorf("failed to return stories to pending: %w", err)
+			return result
+		}
+		passed = false
+		problems = append(problems, "rejected by an afterIteration hook"+because(resp.Reason))
+		classify(result, wr.agent, passed)
+	}
+
+	if result.Status == StatusNoProgress && len(problems) > 0 {
+		result.Message = "failed verification: " + strings.Join(problems, "; ")
+	}
+
+	if result.Status == StatusSuccess {
+		merged, err := l.mergeWorker(ws, wr)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		if !merged {
+			result.Status = StatusNoProgress
+			result.Message = "merge conflict"
+		}
+	}
+
+	current, err := prd.Load(l.Config.Paths.PRD)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to reload PRD: %w", err)
+		return result
+	}
+	_, l.StoriesComplete, _ = current.Stats()
+
+	if result.Status != StatusSuccess {
+		if err := l.trackAttempts(result, current); err != nil {
+			result.Error = err
+		}
+	}
+
+	// Only the worker's own story can have been completed by its merge
+	var completed []prd.UserStory
+	if s := current.GetStory(wr.story.ID); s != nil && result.Status == StatusSuccess {
+		completed = []prd.UserStory{*s}
+	}
+	l.runStoryHooks(ctx, &wr.story, wr.iteration, completed, storyFailure(result, len(problems) > 0), result)
+
+	return result
+}
+
+// mergeWorker commits any leftover work in the worktree, merges the worker
+// branch into the integration branch, and marks the story as passing. On a
+// conflict the merge is aborted, the story is returned to pending with a note
+// so it is retried on top of the updated branch, and false is returned.
+func (l *Loop) mergeWorker(ws *workspace, wr *workerResult) (bool, error) {
+	id := wr.story.ID
+
+	// Collect the worker's copy of the progress log, whose learnings are
+	// merged into the main one
+	var workerLog *progress.Log
+	data, err := os.ReadFile(filepath.Join(wr.worktree, ws.progressRel))
+	switch {
+	case err == nil:
+		workerLog = progress.Parse(string(data))
+	case !os.IsNotExist(err):
+		color.Yellow("⚠ [%s] failed to read the worker's progress log, its learnings are lost: %v", id, err)
+	}
+
+	// Undo the worker's edits to Ralph's own files so they never conflict
+	// (Ralph applies those itself), then commit anything left uncommitted
+	for _, rel := range []string{ws.prdRel, ws.progressRel} {
+		if git.IsTracked(wr.worktree, wr.base, rel) {
+			if _, err := git.Run(wr.worktree, "checkout", wr.base, "--", rel); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if _, err := git.Run(wr.worktree, "rm", "--cached", "-q", "--ignore-unmatch", "--", rel); err != nil {
+			return false, err
+		}
+		_ = os.Remove(filepath.Join(wr.worktree, rel))
+	}
+	if err := git.AddAll(wr.worktree); err != nil {
+		return false, err
+	}
+	if git.HasStagedChanges(wr.worktree) {
+		if err := git.Commit(wr.worktree, fmt.Sprintf("chore: %s - Ralph worker cleanup", id)); err != nil {
+			return false, err
+		}
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	err = git.Merge(ws.root, wr.branch, fmt.Sprintf("Merge %s: %s", id, wr.story.Title))
+	var conflict *git.MergeConflictError
+	if errors.As(err, &conflict) {
+		note := fmt.Sprintf("Merge conflict in %s; returned to pending.", strings.Join(conflict.Files, ", "))
+		if err := l.returnToPending(id, note); err != nil {
+			return false, err
+		}
+		color.Yellow("⊘ [%s] %s", id, note)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to merge %s: %w", wr.branch, err)
+	}
+
+	if _, err := prd.Update(l.Config.Paths.PRD, func(p *prd.PRD) error {
+		return p.MarkDone(id)
+	}); err != nil {
+		return false, err
+	}
+
+	if workerLog != nil {
+		prog, err := progress.Load(ws.progressPath)
+		if err != nil {
+			return false, err
+		}
+		log := progress.Parse(prog.Content)
+		log.Merge(progress.Parse(wr.progress), workerLog)
+		if merged := log.String(); merged != prog.Content {
+			prog.Content = merged
+			if err := prog.Save(); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	// Keep the integration branch history in sync when Ralph's files are tracked
+	var tracked []string
+	for _, rel := range []string{ws.prdRel, ws.progressRel} {
+		if git.IsTracked(ws.root, "HEAD", rel) {
+			tracked = append(tracked, rel)
+		}
+	}
+	if len(tracked) > 0 {
+		if _, err := git.Run(ws.root, append([]string{"add", "--"}, tracked...)...); err != nil {
+			return false, err
+		}
+		if git.HasStagedChanges(ws.root) {
+			if err := git.Commit(ws.root, fmt.Sprintf("chore: %s - mark story as passing", id)); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	color.Green("✓ [%s] merged into %s", id, ws.baseBranch)
+	return true, nil
+}
+
+// excludedStories returns the stories that must not be launched right now:
+// skipped by the stall policy, already running, or backing off after a failure
+func (l *Loop) excludedStories(running map[string]bool, retryAt map[string]time.Time) map[string]bool {
+	excluded := make(map[string]bool, len(l.skipped)+len(running)+len(retryAt))
+	for id := range l.skipped {
+		excluded[id] = true
+	}
+	for id := range running {
+		excluded[id] = true
+	}
+	now := time.Now()
+	for id, at := range retryAt {
+		if now.Before(at) {
+			excluded[id] = true
+		}
+	}
+	return excluded
+}
+
+// nextRetry returns how long until the earliest backed-off story may run again
+func nextRetry(retryAt map[string]time.Time) time.Duration {
+	var wait time.Duration
+	now := time.Now()
+	for _, at := range retryAt {
+		if d := at.Sub(now); d > 0 && (wait == 0 || d < wait) {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// relInside returns path relative to root, failing if it lies outside root
+func relInside(root, path string) (string, error) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, filepath.Join(dir, filepath.Base(path)))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s must be inside the repository", path)
+	}
+	return rel, nil
+}
+
+// outputMu keeps lines from concurrent workers from interleaving. It also
+// guards each prefixWriter's buffer, which an agent's stdout and stderr are
+// copied into from separate goroutines.
+var outputMu sync.Mutex
+
+// prefixWriter prefixes every line of output so concurrent workers stay
+// distinguishable in the terminal
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: prefix}
+}
+
+// Write buffers p and emits every complete line with the prefix
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		pw.emit(pw.buf[:i+1])
+		pw.buf = pw.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits any buffered partial line
+func (pw *prefixWriter) Flush() {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if len(pw.buf) > 0 {
+		pw.emit(append(pw.buf, '\n'))
+		pw.buf = nil
+	}
+}
+
+// emit writes a line with the prefix; outputMu must be held
+func (pw *prefixWriter) emit(line []byte) {
+	fmt.Fprintf(pw.w, "%s%s", pw.prefix, line)
+}
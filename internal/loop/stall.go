@@ -0,0 +1,73 @@
+package loop
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/prd"
+)
+
+// Stall policies applied when a story reaches loop.maxAttemptsPerStory
+const (
+	StallSkip  = "skip"  // skip the story for the rest of this run
+	StallStop  = "stop"  // stop the loop
+	StallBlock = "block" // mark the story as blocked in the PRD and move on
+)
+
+// validateStallPolicy checks that the configured stall policy is known
+func validateStallPolicy(policy string) error {
+	switch policy {
+	case StallSkip, StallStop, StallBlock:
+		return nil
+	default:
+		return fmt.Errorf("unknown stall policy: %s (expected skip, stop or block)", policy)
+	}
+}
+
+// trackAttempts updates the attempt counter for the story worked on in this
+// iteration and applies the stall policy once the story reaches the limit
+func (l *Loop) trackAttempts(result *IterationResult, after *prd.PRD) error {
+	maxAttempts := l.Config.Loop.MaxAttemptsPerStory
+	if maxAttempts <= 0 || l.Attempts == nil || after == nil {
+		return nil
+	}
+
+	story := after.GetStory(result.StoryID)
+	if story == nil || story.Passes {
+		l.Attempts.Reset(result.StoryID)
+		return l.Attempts.Save()
+	}
+
+	attempts := l.Attempts.Increment(story.ID)
+	if attempts < maxAttempts {
+		return l.Attempts.Save()
+	}
+
+	// Give the story a fresh budget if it is picked up again later
+	l.Attempts.Reset(story.ID)
+
+	switch l.Config.Loop.StallPolicy {
+	case StallSkip:
+		l.skipped[strings.ToUpper(story.ID)] = true
+		result.GaveUp = fmt.Sprintf("skipped for this run after %d attempts", attempts)
+		color.Yellow("\n⊘ %s made no progress in %d attempts, skipping it for this run", story.ID, attempts)
+	case StallBlock:
+		note := fmt.Sprintf("Blocked by Ralph after %d attempts without passing.", attempts)
+		updated, err := prd.Update(l.Config.Paths.PRD, func(p *prd.PRD) error {
+			return p.MarkBlocked(story.ID, note)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to block story: %w", err)
+		}
+		l.PRD = updated
+		result.GaveUp = fmt.Sprintf("blocked after %d attempts", attempts)
+		color.Yellow("\n⊘ %s made no progress in %d attempts, marked as blocked", story.ID, attempts)
+	case StallStop:
+		result.Stalled = true
+		result.Message = fmt.Sprintf("%s made no progress in %d attempts", story.ID, attempts)
+		result.GaveUp = result.Message
+	}
+
+	return l.Attempts.Save()
+}
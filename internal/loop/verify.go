@@ -0,0 +1,180 @@
+package loop
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/kylemclaren/ralph/internal/git"
+	"github.com/kylemclaren/ralph/internal/prd"
+)
+
+// verifyBase returns the commit the current iteration started from, or ""
+// if the repository has no commits yet
+func (l *Loop) verifyBase() string {
+	if !l.Config.Verify.Enabled {
+		return ""
+	}
+	head, err := git.HeadCommit(l.repoRoot)
+	if err != nil {
+		return ""
+	}
+	return head
+}
+
+// verifyIteration checks every story that was flipped to passing since before
+// and returns the ones without matching git evidence to pending. It returns
+// the IDs of the reverted stories.
+func (l *Loop) verifyIteration(base string, before *prd.PRD) ([]string, error) {
+	if !l.Config.Verify.Enabled {
+		return nil, nil
+	}
+
+	after, err := prd.Load(l.Config.Paths.PRD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload PRD: %w", err)
+	}
+
+	var reverted []string
+	for _, s := range after.CompletedStories() {
+		if prev := before.GetStory(s.ID); prev != nil && prev.Passes {
+			continue
+		}
+
+		problems, err := l.verifyStory(l.repoRoot, base, s.ID)
+		if err != nil {
+			return reverted, err
+		}
+		if len(problems) == 0 {
+			continue
+		}
+
+		if err := l.rejectStory(s.ID, problems); err != nil {
+			return reverted, err
+		}
+		reverted = append(reverted, s.ID)
+	}
+	return reverted, nil
+}
+
+// verifyStory inspects git in dir for evidence that the story was committed
+// since base. It returns the unmet requirements, or nil if the story is verified.
+func (l *Loop) verifyStory(dir, base, storyID string) ([]string, error) {
+	cfg := l.Config.Verify
+	var problems []string
+
+	head, err := git.HeadCommit(dir)
+	if err != nil {
+		head = ""
+	}
+
+	if cfg.RequireCommit && (head == "" || head == base) {
+		problems = append(problems, "no new commit")
+	}
+
+	if cfg.RequireStoryID && head != "" && head != base {
+		messages, err := git.CommitMessages(dir, base, head)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, msg := range messages {
+			if strings.Contains(strings.ToUpper(msg), strings.ToUpper(storyID)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("no commit message references %s", storyID))
+		}
+	}
+
+	if cfg.RequireCleanTree {
+		changed, err := git.ChangedFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		var dirty []string
+		for _, f := range changed {
+			if !l.isRalphFile(f) {
+				dirty = append(dirty, f)
+			}
+		}
+		if len(dirty) > 0 {
+			problems = append(problems, "uncommitted changes in "+summarizeFiles(dirty, 3))
+		}
+	}
+
+	return problems, nil
+}
+
+// rejectStory returns a story to pending with a note explaining why it
+// failed verification
+func (l *Loop) rejectStory(id string, problems []string) error {
+	reason := strings.Join(problems, "; ")
+	note := fmt.Sprintf("Marked as passing but failed verification (%s); returned to pending.", reason)
+	if err := l.returnToPending(id, note); err != nil {
+		return err
+	}
+
+	color.Yellow("⊘ %s failed verification: %s; returned to pending", id, reason)
+	return nil
+}
+
+// returnToPending marks a story as not passing and adds note to its notes
+func (l *Loop) returnToPending(id, note string) error {
+	_, err := prd.Update(l.Config.Paths.PRD, func(p *prd.PRD) error {
+		s := p.GetStory(id)
+		if s == nil {
+			return fmt.Errorf("story %s not found", id)
+		}
+		s.Passes = false
+		if !strings.Contains(s.Notes, note) {
+			if s.Notes != "" {
+				s.Notes += " "
+			}
+			s.Notes += note
+		}
+		return nil
+	})
+	return err
+}
+
+// isRalphFile reports whether a path relative to the repository root belongs
+// to Ralph's own state, which the agent is expected to leave uncommitted
+func (l *Loop) isRalphFile(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, p := range l.ralphFiles {
+		if rel == p || strings.HasPrefix(rel, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ralphPaths returns Ralph's state files and directories relative to root.
+// Paths outside the repository are left out.
+func ralphPaths(root string, paths ...string) []string {
+	var rels []string
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		rel, err := relInside(root, abs)
+		if err != nil {
+			continue
+		}
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	return rels
+}
+
+// summarizeFiles lists up to max files, noting how many more were left out
+func summarizeFiles(files []string, max int) string {
+	if len(files) <= max {
+		return strings.Join(files, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(files[:max], ", "), len(files)-max)
+}
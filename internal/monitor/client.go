@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clientTimeout bounds a request to the status API of another process
+const clientTimeout = 2 * time.Second
+
+// FetchStatus asks the status API at addr for the Status of its run
+func FetchStatus(ctx context.Context, addr string) (*Status, error) {
+	var status Status
+	if err := fetch(ctx, addr, "/api/status", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// FetchLines asks the status API at addr for the last n lines of agent output
+func FetchLines(ctx context.Context, addr string, n int) ([]Line, error) {
+	var lines []Line
+	if err := fetch(ctx, addr, "/api/output?n="+strconv.Itoa(n), &lines); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// Follow reads the event stream of the status API at addr, passing each event
+// to fn until fn returns false, ctx is done or the server ends the stream
+func Follow(ctx context.Context, addr string, fn func(Event) bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+localAddr(addr)+"/api/events", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status API returned %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var typ, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if e, ok := decodeEvent(typ, data); ok && !fn(e) {
+				return nil
+			}
+			typ, data = "", ""
+		case strings.HasPrefix(line, "event: "):
+			typ = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+func decodeEvent(typ, data string) (Event, bool) {
+	switch typ {
+	case "output":
+		var line Line
+		if err := json.Unmarshal([]byte(data), &line); err == nil {
+			return Event{Type: typ, Data: line}, true
+		}
+	case "status":
+		var status Status
+		if err := json.Unmarshal([]byte(data), &status); err == nil {
+			return Event{Type: typ, Data: status}, true
+		}
+	}
+	return Event{}, false
+}
+
+func fetch(ctx context.Context, addr, path string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, clientTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+localAddr(addr)+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status API returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// localAddr turns a wildcard listen address such as 0.0.0.0:7777 into one a
+// client on the same machine can connect to
+func localAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	return addr
+}
@@ -0,0 +1,298 @@
+// Package monitor keeps the live state of a running loop and serves it over
+// HTTP for `ralph run --serve`: JSON endpoints, server-sent events with the
+// agent's output, and a small dashboard.
+package monitor
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kylemclaren/ralph/internal/agent"
+	"github.com/kylemclaren/ralph/internal/history"
+	"github.com/kylemclaren/ralph/internal/prd"
+)
+
+// maxLines is how many lines of agent output are kept for the API
+const maxLines = 1000
+
+// Activity is an iteration in progress
+type Activity struct {
+	Iteration  int       `json:"iteration"`
+	StoryID    string    `json:"storyId"`
+	StoryTitle string    `json:"storyTitle"`
+	StartedAt  time.Time `json:"startedAt"`
+}
+
+// StoryState is the state of a story in the PRD
+type StoryState struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Passes  bool   `json:"passes"`
+	Blocked bool   `json:"blocked,omitempty"`
+}
+
+// Status is a snapshot of the running loop
+type Status struct {
+	PID             int          `json:"pid"`
+	RunID           string       `json:"runId,omitempty"`
+	Mode            string       `json:"mode"`
+	Agent           string       `json:"agent"`
+	Branch          string       `json:"branch"`
+	State           string       `json:"state"`            // running or finished
+	Reason          string       `json:"reason,omitempty"` // why the run finished
+	Paused          bool         `json:"paused,omitempty"` // waiting for 'ralph resume' before the next iteration
+	StartedAt       time.Time    `json:"startedAt"`
+	ElapsedSeconds  int          `json:"elapsedSeconds"`
+	Iteration       int          `json:"iteration"` // latest iteration started
+	MaxIterations   int          `json:"maxIterations"`
+	Active          []Activity   `json:"active"` // iterations in progress
+	LastStatus      string       `json:"lastStatus,omitempty"`
+	StoriesTotal    int          `json:"storiesTotal"`
+	StoriesComplete int          `json:"storiesComplete"`
+	Stories         []StoryState `json:"stories"`
+	Usage           agent.Usage  `json:"usage"`
+}
+
+// Line is a line of agent output
+type Line struct {
+	Seq       int       `json:"seq"` // increasing number of the line within the run
+	Iteration int       `json:"iteration"`
+	StoryID   string    `json:"storyId"`
+	Text      string    `json:"text"`
+	Time      time.Time `json:"time"`
+}
+
+// Event is sent to subscribers: an output Line, or the Status after an
+// iteration started or finished
+type Event struct {
+	Type string      // "output" or "status"
+	Data interface{} // Line or Status
+}
+
+// Monitor tracks a running loop. A nil *Monitor ignores every update, so the
+// loop can report to it unconditionally.
+type Monitor struct {
+	run     *history.Run
+	prdPath string
+
+	mu     sync.Mutex
+	status Status
+	active map[int]Activity
+	lines  []Line
+	seq    int
+	subs   map[chan Event]struct{}
+}
+
+// New creates a monitor for a run recorded in the run history
+func New(run *history.Run, prdPath string) *Monitor {
+	return &Monitor{
+		run:     run,
+		prdPath: prdPath,
+		status: Status{
+			PID:           os.Getpid(),
+			RunID:         run.ID,
+			Mode:          run.Mode,
+			Agent:         run.Agent,
+			Branch:        run.Branch,
+			State:         "running",
+			StartedAt:     run.StartedAt,
+			MaxIterations: run.MaxIterations,
+		},
+		active: make(map[int]Activity),
+		subs:   make(map[chan Event]struct{}),
+	}
+}
+
+// IterationStarted records that the agent starts working on story
+func (m *Monitor) IterationStarted(iteration int, story *prd.UserStory) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.active[iteration] = Activity{
+		Iteration:  iteration,
+		StoryID:    story.ID,
+		StoryTitle: story.Title,
+		StartedAt:  time.Now(),
+	}
+	if iteration > m.status.Iteration {
+		m.status.Iteration = iteration
+	}
+	m.mu.Unlock()
+	m.publishStatus()
+}
+
+// IterationFinished records an iteration's outcome and the run's usage so far
+func (m *Monitor) IterationFinished(iteration int, status string, usage agent.Usage) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	delete(m.active, iteration)
+	if iteration > m.status.Iteration {
+		m.status.Iteration = iteration
+	}
+	m.status.LastStatus = status
+	m.status.Usage = usage
+	m.mu.Unlock()
+	m.publishStatus()
+}
+
+// SetPaused records whether the loop is paused
+func (m *Monitor) SetPaused(paused bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.status.Paused = paused
+	m.mu.Unlock()
+	m.publishStatus()
+}
+
+// Finish records that the run ended
+func (m *Monitor) Finish(reason string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.active = make(map[int]Activity)
+	m.status.State = "finished"
+	m.status.Reason = reason
+	m.status.Paused = false
+	m.mu.Unlock()
+	m.publishStatus()
+}
+
+// Status returns a snapshot of the run with the story counts of the PRD on
+// disk
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	s := m.status
+	s.Active = make([]Activity, 0, len(m.active))
+	for _, a := range m.active {
+		s.Active = append(s.Active, a)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(s.Active, func(i, j int) bool { return s.Active[i].Iteration < s.Active[j].Iteration })
+	s.ElapsedSeconds = int(time.Since(s.StartedAt).Seconds())
+	s.Stories = []StoryState{}
+	if p, err := prd.Load(m.prdPath); err == nil {
+		s.StoriesTotal, s.StoriesComplete, _ = p.Stats()
+		for _, story := range p.UserStories {
+			s.Stories = append(s.Stories, StoryState{
+				ID:      story.ID,
+				Title:   story.Title,
+				Passes:  story.Passes,
+				Blocked: story.Blocked,
+			})
+		}
+	}
+	return s
+}
+
+// Lines returns up to the last n lines of agent output (all kept if n <= 0)
+func (m *Monitor) Lines(n int) []Line {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n <= 0 || n > len(m.lines) {
+		n = len(m.lines)
+	}
+	return append([]Line(nil), m.lines[len(m.lines)-n:]...)
+}
+
+// Iterations returns the iterations recorded so far
+func (m *Monitor) Iterations() ([]*history.Iteration, error) {
+	return m.run.LoadIterations()
+}
+
+// Subscribe returns a channel receiving events until cancel is called. Events
+// are dropped for a subscriber that falls behind rather than stalling the
+// agent.
+func (m *Monitor) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 256)
+	m.mu.Lock()
+	m.subs[ch] = struct{}{}
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		delete(m.subs, ch)
+		m.mu.Unlock()
+	}
+}
+
+// Writer returns a writer that records the agent output of an iteration line
+// by line. Close records a final line without a newline.
+func (m *Monitor) Writer(iteration int, storyID string) io.WriteCloser {
+	return &lineWriter{m: m, iteration: iteration, storyID: storyID}
+}
+
+func (m *Monitor) addLine(iteration int, storyID, text string) {
+	m.mu.Lock()
+	m.seq++
+	line := Line{Seq: m.seq, Iteration: iteration, StoryID: storyID, Text: text, Time: time.Now()}
+	m.lines = append(m.lines, line)
+	if len(m.lines) > maxLines {
+		m.lines = append([]Line(nil), m.lines[len(m.lines)-maxLines:]...)
+	}
+	m.broadcast(Event{Type: "output", Data: line})
+	m.mu.Unlock()
+}
+
+func (m *Monitor) publishStatus() {
+	status := m.Status()
+	m.mu.Lock()
+	m.broadcast(Event{Type: "status", Data: status})
+	m.mu.Unlock()
+}
+
+// broadcast sends an event to every subscriber; m.mu must be held
+func (m *Monitor) broadcast(e Event) {
+	for ch := range m.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// lineWriter splits output into lines for the monitor
+type lineWriter struct {
+	m         *Monitor
+	iteration int
+	storyID   string
+
+	mu  sync.Mutex // stdout and stderr may be written concurrently
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.m.addLine(w.iteration, w.storyID, strings.TrimRight(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.m.addLine(w.iteration, w.storyID, string(w.buf))
+		w.buf = nil
+	}
+	return nil
+}
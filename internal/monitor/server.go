@@ -0,0 +1,185 @@
+package monitor
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kylemclaren/ralph/internal/history"
+)
+
+// DefaultLines is how many lines of agent output /api/output returns unless
+// asked for another number
+const DefaultLines = 100
+
+//go:embed dashboard.html
+var dashboard []byte
+
+// Server serves a monitor over HTTP:
+//
+//	GET /                 the dashboard
+//	GET /api/status       the Status of the run
+//	GET /api/output?n=N   the last N lines of agent output
+//	GET /api/history      the iterations recorded so far
+//	GET /api/events       server-sent events: "status" and "output"
+type Server struct {
+	Addr string // address the server listens on
+
+	srv *http.Server
+}
+
+// Serve starts serving m on addr in the background. An address without a
+// host, such as ":7777", listens on localhost only.
+func Serve(m *Monitor, addr string) (*Server, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start status API: %w", err)
+	}
+
+	s := &Server{
+		Addr: ln.Addr().String(),
+		srv:  &http.Server{Handler: Handler(m), ReadHeaderTimeout: 10 * time.Second},
+	}
+	go func() { _ = s.srv.Serve(ln) }()
+	return s, nil
+}
+
+// Close stops the server, ending open event streams
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return s.srv.Close()
+}
+
+// Handler returns the HTTP handler for a monitor
+func Handler(m *Monitor) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(dashboard)
+	})
+
+	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, m.Status())
+	})
+
+	mux.HandleFunc("/api/output", func(w http.ResponseWriter, r *http.Request) {
+		n := DefaultLines
+		if v := r.URL.Query().Get("n"); v != "" {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil {
+				http.Error(w, "n must be a number", http.StatusBadRequest)
+				return
+			}
+		}
+		writeJSON(w, m.Lines(n))
+	})
+
+	mux.HandleFunc("/api/history", func(w http.ResponseWriter, r *http.Request) {
+		iterations, err := m.Iterations()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if iterations == nil {
+			iterations = []*history.Iteration{}
+		}
+		writeJSON(w, iterations)
+	})
+
+	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		serveEvents(m, w, r)
+	})
+
+	return mux
+}
+
+// serveEvents streams status changes and agent output as server-sent events,
+// starting with the current status and the output kept so far
+func serveEvents(m *Monitor, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := m.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	// A reconnecting client has seen the lines up to Last-Event-ID. Lines
+	// already sent from the backlog may also arrive as events; skip them.
+	sent, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	send := func(e Event) {
+		if line, ok := e.Data.(Line); ok {
+			if line.Seq <= sent {
+				return
+			}
+			sent = line.Seq
+		}
+		writeEvent(w, e)
+	}
+
+	send(Event{Type: "status", Data: m.Status()})
+	for _, line := range m.Lines(DefaultLines) {
+		send(Event{Type: "output", Data: line})
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-events:
+			send(e)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e Event) {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return
+	}
+	if line, ok := e.Data.(Line); ok {
+		fmt.Fprintf(w, "id: %d\n", line.Seq)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EventType is a point of the run a notification can be sent for
+type EventType string
+
+const (
+	EventStart         EventType = "start"         // the run started
+	EventStoryComplete EventType = "storyComplete" // a story started passing
+	EventFailure       EventType = "failure"       // the run stopped without completing
+	EventMaxIterations EventType = "maxIterations" // the run used up its iterations
+	EventComplete      EventType = "complete"      // all stories pass
+)
+
+// Events lists every event type in lifecycle order
+var Events = []EventType{
+	EventStart,
+	EventStoryComplete,
+	EventFailure,
+	EventMaxIterations,
+	EventComplete,
+}
+
+// ParseEvent returns the event type named s
+func ParseEvent(s string) (EventType, error) {
+	for _, t := range Events {
+		if strings.EqualFold(string(t), s) {
+			return t, nil
+		}
+	}
+	names := make([]string, len(Events))
+	for i, t := range Events {
+		names[i] = string(t)
+	}
+	return "", fmt.Errorf("unknown notification event: %s (expected %s)", s, strings.Join(names, ", "))
+}
+
+// Event is a notification about the run
+type Event struct {
+	Type            EventType     `json:"event"`
+	Project         string        `json:"project,omitempty"`
+	Branch          string        `json:"branch,omitempty"`
+	StoryID         string        `json:"storyId,omitempty"`
+	StoryTitle      string        `json:"storyTitle,omitempty"`
+	Iteration       int           `json:"iteration"`
+	MaxIterations   int           `json:"maxIterations"`
+	StoriesComplete int           `json:"storiesComplete"`
+	StoriesTotal    int           `json:"storiesTotal"`
+	Reason          string        `json:"reason,omitempty"` // why the run failed
+	Duration        time.Duration `json:"-"`                // time since the run started
+	Time            time.Time     `json:"time"`
+}
+
+// Notifier posts events to a webhook
+type Notifier struct {
+	URL     string
+	Format  Format
+	Events  []EventType   // events to send (empty = all)
+	Retries int           // extra attempts after a failed delivery
+	Backoff time.Duration // delay before the first retry, doubling after each
+	Client  *http.Client
+}
+
+// New creates a notifier for a webhook URL with the default format detection,
+// retries and timeout
+func New(url string) *Notifier {
+	return &Notifier{
+		URL:     url,
+		Format:  FormatAuto,
+		Retries: 3,
+		Backoff: time.Second,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Wants reports whether the notifier sends events of type t
+func (n *Notifier) Wants(t EventType) bool {
+	if len(n.Events) == 0 {
+		return true
+	}
+	for _, e := range n.Events {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Send posts an event to the webhook unless it is filtered out. Failed
+// deliveries are retried with backoff, except for client errors other than
+// 429, which a retry would not fix.
+func (n *Notifier) Send(ctx context.Context, e Event) error {
+	if n == nil || !n.Wants(e.Type) {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	body, err := Payload(n.format(), e)
+	if err != nil {
+		return err
+	}
+
+	backoff := n.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= n.Retries || ctx.Err() != nil {
+			return fmt.Errorf("failed to send %s notification: %w", e.Type, err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("failed to send %s notification: %w", e.Type, ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// post delivers a payload once, reporting whether a failure is worth retrying
+func (n *Notifier) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ralph")
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("webhook returned %s", resp.Status)
+	if msg := strings.TrimSpace(string(detail)); msg != "" {
+		err = fmt.Errorf("%w: %s", err, msg)
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, err
+}
+
+// format resolves FormatAuto from the webhook URL
+func (n *Notifier) format() Format {
+	if n.Format == "" || n.Format == FormatAuto {
+		return DetectFormat(n.URL)
+	}
+	return n.Format
+}
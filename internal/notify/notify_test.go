@@ -0,0 +1,316 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhook is a local webhook that records the bodies posted to it and answers
+// with the given status codes in turn, then 200
+type webhook struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	server   *httptest.Server
+}
+
+func newWebhook(t *testing.T, statuses ...int) *webhook {
+	t.Helper()
+	w := &webhook{statuses: statuses}
+	w.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.mu.Lock()
+		w.bodies = append(w.bodies, body)
+		status := http.StatusOK
+		if len(w.statuses) > 0 {
+			status, w.statuses = w.statuses[0], w.statuses[1:]
+		}
+		w.mu.Unlock()
+		rw.WriteHeader(status)
+	}))
+	t.Cleanup(w.server.Close)
+	return w
+}
+
+func (w *webhook) received() [][]byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([][]byte(nil), w.bodies...)
+}
+
+// notifier returns a notifier for the webhook that retries quickly
+func (w *webhook) notifier(format Format) *Notifier {
+	n := New(w.server.URL)
+	n.Format = format
+	n.Backoff = time.Millisecond
+	n.Client = w.server.Client()
+	return n
+}
+
+var testEvent = Event{
+	Type:            EventStoryComplete,
+	Project:         "my-app",
+	Branch:          "ralph/feature",
+	StoryID:         "US-002",
+	StoryTitle:      "Add login form",
+	Iteration:       3,
+	MaxIterations:   25,
+	StoriesComplete: 2,
+	StoriesTotal:    5,
+	Duration:        412 * time.Second,
+	Time:            time.Date(2026, 1, 16, 15, 4, 5, 0, time.UTC),
+}
+
+func sendOne(t *testing.T, format Format) map[string]any {
+	t.Helper()
+	w := newWebhook(t)
+	if err := w.notifier(format).Send(context.Background(), testEvent); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	bodies := w.received()
+	if len(bodies) != 1 {
+		t.Fatalf("webhook received %d requests, want 1", len(bodies))
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(bodies[0], &payload); err != nil {
+		t.Fatalf("payload is not JSON: %v\n%s", err, bodies[0])
+	}
+	return payload
+}
+
+func TestSendSlack(t *testing.T) {
+	var msg slackMessage
+	remarshal(t, sendOne(t, FormatSlack), &msg)
+
+	if msg.Text != "*Story complete: US-002 - Add login form*" {
+		t.Errorf("text = %q", msg.Text)
+	}
+	if len(msg.Attachments) != 1 {
+		t.Fatalf("got %d attachments, want 1", len(msg.Attachments))
+	}
+	a := msg.Attachments[0]
+	if a.Color != "#2eb67d" {
+		t.Errorf("color = %q, want #2eb67d", a.Color)
+	}
+	if a.Ts != testEvent.Time.Unix() {
+		t.Errorf("ts = %d, want %d", a.Ts, testEvent.Time.Unix())
+	}
+	want := map[string]string{
+		"Project":   "my-app",
+		"Branch":    "ralph/feature",
+		"Stories":   "2/5 complete",
+		"Iteration": "3/25",
+		"Duration":  "6m52s",
+	}
+	if len(a.Fields) != len(want) {
+		t.Errorf("got %d fields, want %d: %+v", len(a.Fields), len(want), a.Fields)
+	}
+	for _, f := range a.Fields {
+		if want[f.Title] != f.Value {
+			t.Errorf("field %s = %q, want %q", f.Title, f.Value, want[f.Title])
+		}
+	}
+}
+
+func TestSendDiscord(t *testing.T) {
+	var msg discordMessage
+	remarshal(t, sendOne(t, FormatDiscord), &msg)
+
+	if msg.Username != "Ralph" {
+		t.Errorf("username = %q, want Ralph", msg.Username)
+	}
+	if len(msg.Embeds) != 1 {
+		t.Fatalf("got %d embeds, want 1", len(msg.Embeds))
+	}
+	e := msg.Embeds[0]
+	if e.Title != "Story complete: US-002 - Add login form" {
+		t.Errorf("title = %q", e.Title)
+	}
+	if e.Color != 0x2eb67d {
+		t.Errorf("color = %#x, want 0x2eb67d", e.Color)
+	}
+	if e.Timestamp != "2026-01-16T15:04:05Z" {
+		t.Errorf("timestamp = %q", e.Timestamp)
+	}
+	if len(e.Fields) == 0 || e.Fields[0].Name != "Project" || e.Fields[0].Value != "my-app" || !e.Fields[0].Inline {
+		t.Errorf("fields = %+v, want Project first", e.Fields)
+	}
+}
+
+func TestSendJSON(t *testing.T) {
+	payload := sendOne(t, FormatJSON)
+
+	want := map[string]any{
+		"event":           "storyComplete",
+		"project":         "my-app",
+		"branch":          "ralph/feature",
+		"storyId":         "US-002",
+		"storyTitle":      "Add login form",
+		"iteration":       float64(3),
+		"maxIterations":   float64(25),
+		"storiesComplete": float64(2),
+		"storiesTotal":    float64(5),
+		"time":            "2026-01-16T15:04:05Z",
+		"durationSeconds": float64(412),
+	}
+	for k, v := range want {
+		if payload[k] != v {
+			t.Errorf("%s = %v, want %v", k, payload[k], v)
+		}
+	}
+	if len(payload) != len(want) {
+		t.Errorf("payload has %d fields, want %d: %v", len(payload), len(want), payload)
+	}
+}
+
+func TestSendRetriesServerErrors(t *testing.T) {
+	w := newWebhook(t, http.StatusInternalServerError, http.StatusBadGateway)
+	n := w.notifier(FormatJSON)
+
+	start := time.Now()
+	if err := n.Send(context.Background(), testEvent); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := len(w.received()); got != 3 {
+		t.Errorf("webhook received %d requests, want 3", got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send took %s with a 1ms backoff", elapsed)
+	}
+}
+
+func TestSendGivesUpAfterRetries(t *testing.T) {
+	w := newWebhook(t, 500, 500, 500, 500, 500)
+	n := w.notifier(FormatJSON)
+	n.Retries = 2
+
+	if err := n.Send(context.Background(), testEvent); err == nil {
+		t.Fatal("Send succeeded, want an error")
+	}
+	if got := len(w.received()); got != 3 {
+		t.Errorf("webhook received %d requests, want 3", got)
+	}
+}
+
+func TestSendDoesNotRetryClientErrors(t *testing.T) {
+	w := newWebhook(t, http.StatusNotFound)
+
+	if err := w.notifier(FormatJSON).Send(context.Background(), testEvent); err == nil {
+		t.Fatal("Send succeeded, want an error")
+	}
+	if got := len(w.received()); got != 1 {
+		t.Errorf("webhook received %d requests, want 1", got)
+	}
+}
+
+func TestSendSkipsFilteredEvents(t *testing.T) {
+	w := newWebhook(t)
+	n := w.notifier(FormatJSON)
+	n.Events = []EventType{EventFailure, EventComplete}
+
+	for _, typ := range []EventType{EventStart, EventStoryComplete, EventMaxIterations} {
+		e := testEvent
+		e.Type = typ
+		if err := n.Send(context.Background(), e); err != nil {
+			t.Fatalf("Send %s: %v", typ, err)
+		}
+	}
+	if got := len(w.received()); got != 0 {
+		t.Fatalf("webhook received %d filtered-out events", got)
+	}
+
+	e := testEvent
+	e.Type = EventComplete
+	if err := n.Send(context.Background(), e); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := len(w.received()); got != 1 {
+		t.Errorf("webhook received %d requests, want 1", got)
+	}
+}
+
+func TestQueueSendsInOrder(t *testing.T) {
+	w := newWebhook(t, http.StatusServiceUnavailable)
+	n := w.notifier(FormatJSON)
+	n.Events = []EventType{EventStart, EventComplete}
+
+	var errs []error
+	q := NewQueue(n, func(err error) { errs = append(errs, err) })
+	for _, typ := range []EventType{EventStart, EventStoryComplete, EventComplete} {
+		e := testEvent
+		e.Type = typ
+		q.Send(e)
+	}
+	if !q.Close(5 * time.Second) {
+		t.Fatal("queue did not drain")
+	}
+	if len(errs) > 0 {
+		t.Errorf("delivery errors: %v", errs)
+	}
+
+	// The start event is retried once; the filtered-out storyComplete event
+	// is never sent
+	var got []string
+	for _, body := range w.received() {
+		var payload struct {
+			Event string `json:"event"`
+		}
+		remarshal(t, body, &payload)
+		got = append(got, payload.Event)
+	}
+	want := []string{"start", "start", "complete"}
+	if len(got) != len(want) {
+		t.Fatalf("webhook received %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("webhook received %v, want %v", got, want)
+		}
+	}
+}
+
+func TestQueueCloseGivesUp(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	n := New(server.URL)
+	n.Client = server.Client()
+	q := NewQueue(n, nil)
+	q.Send(testEvent)
+
+	start := time.Now()
+	if q.Close(50 * time.Millisecond) {
+		t.Error("Close reported the stuck event as sent")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close took %s with a 50ms timeout", elapsed)
+	}
+}
+
+// remarshal decodes v, a decoded JSON value or raw JSON, into out
+func remarshal(t *testing.T, v any, out any) {
+	t.Helper()
+	data, ok := v.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatal(err)
+	}
+}
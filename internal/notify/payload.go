@@ -0,0 +1,212 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Format is the payload shape a webhook expects
+type Format string
+
+const (
+	FormatAuto    Format = "auto"    // detected from the webhook URL
+	FormatSlack   Format = "slack"   // Slack incoming webhook
+	FormatDiscord Format = "discord" // Discord webhook
+	FormatJSON    Format = "json"    // the Event as JSON
+)
+
+// ParseFormat returns the format named s; "" is FormatAuto
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case "":
+		return FormatAuto, nil
+	case FormatAuto, FormatSlack, FormatDiscord, FormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown notification format: %s (expected auto, slack, discord or json)", s)
+	}
+}
+
+// DetectFormat picks the format for a webhook URL: Slack and Discord
+// webhooks by their host, generic JSON for anything else
+func DetectFormat(webhook string) Format {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return FormatJSON
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case host == "hooks.slack.com":
+		return FormatSlack
+	case (host == "discord.com" || host == "discordapp.com" || strings.HasSuffix(host, ".discord.com")) &&
+		strings.HasPrefix(u.Path, "/api/webhooks/"):
+		return FormatDiscord
+	default:
+		return FormatJSON
+	}
+}
+
+// Payload renders the request body for an event in the given format
+func Payload(format Format, e Event) ([]byte, error) {
+	switch format {
+	case FormatSlack:
+		return json.Marshal(slackPayload(e))
+	case FormatDiscord:
+		return json.Marshal(discordPayload(e))
+	case FormatJSON, FormatAuto, "":
+		return json.Marshal(jsonPayload{Event: e, DurationSeconds: int(e.Duration.Seconds())})
+	default:
+		return nil, fmt.Errorf("unknown notification format: %s", format)
+	}
+}
+
+// jsonPayload is the generic payload: the event with its duration in seconds
+type jsonPayload struct {
+	Event
+	DurationSeconds int `json:"durationSeconds"`
+}
+
+// Title summarizes an event in one line
+func (e Event) Title() string {
+	switch e.Type {
+	case EventStart:
+		return "Ralph started"
+	case EventStoryComplete:
+		return fmt.Sprintf("Story complete: %s - %s", e.StoryID, e.StoryTitle)
+	case EventFailure:
+		return "Ralph failed"
+	case EventMaxIterations:
+		return fmt.Sprintf("Ralph reached max iterations (%d)", e.MaxIterations)
+	case EventComplete:
+		return "All stories complete"
+	default:
+		return "Ralph: " + string(e.Type)
+	}
+}
+
+// field is a labelled value shown by the chat formats
+type field struct {
+	name  string
+	value string
+}
+
+// fields lists the event details worth showing, skipping empty ones
+func (e Event) fields() []field {
+	var fields []field
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, field{name, value})
+		}
+	}
+	add("Project", e.Project)
+	add("Branch", e.Branch)
+	if e.Type != EventStoryComplete && e.StoryID != "" {
+		add("Story", e.StoryID+" - "+e.StoryTitle)
+	}
+	add("Stories", fmt.Sprintf("%d/%d complete", e.StoriesComplete, e.StoriesTotal))
+	if e.Iteration > 0 {
+		add("Iteration", fmt.Sprintf("%d/%d", e.Iteration, e.MaxIterations))
+	}
+	if e.Duration >= time.Second {
+		add("Duration", e.Duration.Round(time.Second).String())
+	}
+	add("Reason", shorten(e.Reason, maxFieldLen))
+	return fields
+}
+
+// maxFieldLen keeps field values within Discord's limit of 1024 characters
+const maxFieldLen = 1000
+
+// shorten cuts s to at most n runes
+func shorten(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// color is the accent of an event in the chat formats, as 0xRRGGBB
+func (e Event) color() int {
+	switch e.Type {
+	case EventStoryComplete, EventComplete:
+		return 0x2eb67d // green
+	case EventFailure:
+		return 0xe01e5a // red
+	case EventMaxIterations:
+		return 0xecb22e // yellow
+	default:
+		return 0x36c5f0 // blue
+	}
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackAttachment struct {
+	Color    string       `json:"color"`
+	Fallback string       `json:"fallback"`
+	Fields   []slackField `json:"fields"`
+	Ts       int64        `json:"ts"`
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+func slackPayload(e Event) slackMessage {
+	fields := make([]slackField, 0, len(e.fields()))
+	for _, f := range e.fields() {
+		fields = append(fields, slackField{Title: f.name, Value: f.value, Short: f.name != "Reason"})
+	}
+	return slackMessage{
+		Text: "*" + e.Title() + "*",
+		Attachments: []slackAttachment{{
+			Color:    fmt.Sprintf("#%06x", e.color()),
+			Fallback: e.Title(),
+			Fields:   fields,
+			Ts:       e.Time.Unix(),
+		}},
+	}
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title     string         `json:"title"`
+	Color     int            `json:"color"`
+	Fields    []discordField `json:"fields"`
+	Timestamp string         `json:"timestamp"`
+}
+
+type discordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+func discordPayload(e Event) discordMessage {
+	fields := make([]discordField, 0, len(e.fields()))
+	for _, f := range e.fields() {
+		fields = append(fields, discordField{Name: f.name, Value: f.value, Inline: f.name != "Reason"})
+	}
+	return discordMessage{
+		Username: "Ralph",
+		Embeds: []discordEmbed{{
+			Title:     shorten(e.Title(), 256),
+			Color:     e.color(),
+			Fields:    fields,
+			Timestamp: e.Time.UTC().Format(time.RFC3339),
+		}},
+	}
+}
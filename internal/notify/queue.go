@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// queueSize bounds how many events can wait to be sent; more are dropped
+const queueSize = 64
+
+// Queue sends events in the background, one at a time and in order, so a slow
+// or unreachable webhook does not hold up the run
+type Queue struct {
+	n       *Notifier
+	onError func(error) // called from the queue's goroutine
+
+	mu     sync.Mutex
+	closed bool
+	events chan Event
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewQueue starts sending the events queued for n. onError is told about
+// events that could not be delivered.
+func NewQueue(n *Notifier, onError func(error)) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		n:       n,
+		onError: onError,
+		events:  make(chan Event, queueSize),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	go q.run()
+	return q
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	for e := range q.events {
+		if err := q.n.Send(q.ctx, e); err != nil {
+			q.fail(err)
+		}
+	}
+}
+
+func (q *Queue) fail(err error) {
+	if q.onError != nil {
+		q.onError(err)
+	}
+}
+
+// Send queues an event unless the notifier filters it out. It never blocks:
+// an event is dropped when the queue is full or closed.
+func (q *Queue) Send(e Event) {
+	if q == nil || !q.n.Wants(e.Type) {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	select {
+	case q.events <- e:
+	default:
+		go q.fail(fmt.Errorf("dropped %s notification: too many are waiting to be sent", e.Type))
+	}
+}
+
+// Close stops taking events and waits up to timeout for the queued ones to be
+// sent, then gives up on the rest. It reports whether all of them were
+// delivered or failed in time.
+func (q *Queue) Close(timeout time.Duration) bool {
+	if q == nil {
+		return true
+	}
+
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.events)
+	}
+	q.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	defer q.cancel()
+	select {
+	case <-q.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
@@ -1,12 +1,16 @@
 package pidfile
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
 const DefaultPIDFileName = ".ralph.pid"
@@ -19,6 +23,7 @@ var (
 // PIDFile manages the Ralph process ID file
 type PIDFile struct {
 	path string
+	mu   sync.Mutex // serializes Update
 }
 
 // New creates a new PIDFile manager
@@ -37,6 +42,17 @@ func (p *PIDFile) Path() string {
 	return p.path
 }
 
+// Info is what the PID file records about the running loop
+type Info struct {
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+	RunID     string    `json:"runId,omitempty"`    // run history ID
+	LogPath   string    `json:"logPath,omitempty"`  // console log of a detached run
+	Addr      string    `json:"addr,omitempty"`     // status API address, set with --serve
+	Stopping  bool      `json:"stopping,omitempty"` // asked to stop after the current iteration
+	Paused    bool      `json:"paused,omitempty"`   // waiting for 'ralph resume'
+}
+
 // Write writes the current process ID to the PID file
 func (p *PIDFile) Write() error {
 	// Check if already running
@@ -48,26 +64,63 @@ func (p *PIDFile) Write() error {
 		_ = p.Remove()
 	}
 
-	pid := os.Getpid()
-	return os.WriteFile(p.path, []byte(strconv.Itoa(pid)), 0644)
+	return p.save(&Info{PID: os.Getpid(), StartedAt: time.Now()})
+}
+
+// Update changes the recorded information of the current process
+func (p *PIDFile) Update(fn func(*Info)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	info, err := p.ReadInfo()
+	if err != nil {
+		return err
+	}
+	fn(info)
+	return p.save(info)
 }
 
 // Read reads the PID from the file
 func (p *PIDFile) Read() (int, error) {
+	info, err := p.ReadInfo()
+	if err != nil {
+		return 0, err
+	}
+	return info.PID, nil
+}
+
+// ReadInfo reads everything the PID file records. Files written by older
+// versions hold only the PID.
+func (p *PIDFile) ReadInfo() (*Info, error) {
 	data, err := os.ReadFile(p.path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return 0, ErrNotRunning
+			return nil, ErrNotRunning
 		}
-		return 0, err
+		return nil, err
 	}
 
-	pid, err := strconv.Atoi(string(data))
-	if err != nil {
-		return 0, fmt.Errorf("invalid PID file: %w", err)
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+		return &Info{PID: pid}, nil
 	}
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil || info.PID <= 0 {
+		return nil, fmt.Errorf("invalid PID file: %s", p.path)
+	}
+	return &info, nil
+}
 
-	return pid, nil
+// save writes info atomically, so a concurrent reader never sees it half
+// written
+func (p *PIDFile) save(info *Info) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
 }
 
 // Remove removes the PID file
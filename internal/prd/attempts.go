@@ -0,0 +1,82 @@
+package prd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AttemptsFileName is the name of the attempts file stored next to the PRD
+const AttemptsFileName = "attempts.json"
+
+// Attempts tracks how many iterations each story has been worked on without
+// passing. It is persisted next to the PRD so counts survive across runs.
+type Attempts struct {
+	path    string
+	Stories map[string]int `json:"stories"`
+}
+
+// AttemptsPath returns the attempts file path for the given PRD path
+func AttemptsPath(prdPath string) string {
+	return filepath.Join(filepath.Dir(prdPath), AttemptsFileName)
+}
+
+// LoadAttempts reads the attempts file that belongs to the given PRD path.
+// A missing file yields empty counters.
+func LoadAttempts(prdPath string) (*Attempts, error) {
+	a := &Attempts{
+		path:    AttemptsPath(prdPath),
+		Stories: make(map[string]int),
+	}
+
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return a, nil
+		}
+		return nil, fmt.Errorf("failed to read attempts file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, a); err != nil {
+		return nil, fmt.Errorf("failed to parse attempts file: %w", err)
+	}
+	if a.Stories == nil {
+		a.Stories = make(map[string]int)
+	}
+
+	return a, nil
+}
+
+// Save writes the attempts file. The file is replaced atomically, like the
+// PRD.
+func (a *Attempts) Save() error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal attempts: %w", err)
+	}
+
+	if err := writeFileAtomic(a.path, data); err != nil {
+		return fmt.Errorf("failed to write attempts file: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns the number of attempts recorded for a story
+func (a *Attempts) Get(id string) int {
+	return a.Stories[strings.ToUpper(id)]
+}
+
+// Increment records another attempt for a story and returns the new count
+func (a *Attempts) Increment(id string) int {
+	id = strings.ToUpper(id)
+	a.Stories[id]++
+	return a.Stories[id]
+}
+
+// Reset clears the attempt counter for a story
+func (a *Attempts) Reset(id string) {
+	delete(a.Stories, strings.ToUpper(id))
+}
@@ -0,0 +1,110 @@
+package prd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChecksFileName is the name of the failed checks file stored next to the PRD
+const ChecksFileName = "checks.json"
+
+// CheckFailure records an acceptance check that did not exit 0
+type CheckFailure struct {
+	Criterion string    `json:"criterion"`
+	Command   string    `json:"command"`
+	ExitCode  int       `json:"exitCode"`
+	Output    string    `json:"output"`
+	Error     string    `json:"error,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// CheckFailures holds the latest failed acceptance checks of each story. It is
+// persisted next to the PRD so the next iteration's prompt can include them,
+// even when that iteration runs in a later 'ralph run'.
+type CheckFailures struct {
+	path    string
+	mu      sync.Mutex
+	Stories map[string][]CheckFailure `json:"stories"`
+}
+
+// ChecksPath returns the failed checks file path for the given PRD path
+func ChecksPath(prdPath string) string {
+	return filepath.Join(filepath.Dir(prdPath), ChecksFileName)
+}
+
+// LoadCheckFailures reads the failed checks file that belongs to the given
+// PRD path. A missing file yields no failures.
+func LoadCheckFailures(prdPath string) (*CheckFailures, error) {
+	c := &CheckFailures{
+		path:    ChecksPath(prdPath),
+		Stories: make(map[string][]CheckFailure),
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("failed to read checks file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse checks file: %w", err)
+	}
+	if c.Stories == nil {
+		c.Stories = make(map[string][]CheckFailure)
+	}
+
+	return c, nil
+}
+
+// Save writes the failed checks file, removing it once no failures remain. The
+// file is replaced atomically, like the PRD.
+func (c *CheckFailures) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.Stories) == 0 {
+		if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove checks file: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checks: %w", err)
+	}
+
+	if err := writeFileAtomic(c.path, data); err != nil {
+		return fmt.Errorf("failed to write checks file: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns the failed checks recorded for a story
+func (c *CheckFailures) Get(id string) []CheckFailure {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Stories[strings.ToUpper(id)]
+}
+
+// Set records the failed checks of a story, replacing earlier ones
+func (c *CheckFailures) Set(id string, failures []CheckFailure) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Stories[strings.ToUpper(id)] = failures
+}
+
+// Clear forgets the failed checks of a story
+func (c *CheckFailures) Clear(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.Stories, strings.ToUpper(id))
+}
@@ -0,0 +1,76 @@
+package prd
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Criterion is a single acceptance criterion. In the PRD it is either a plain
+// string or an object with a shell command Ralph runs to verify it:
+//
+//	"typecheck passes"
+//	{"text": "tests pass", "check": "go test ./..."}
+type Criterion struct {
+	Text  string `json:"text"`
+	Check string `json:"check,omitempty"` // shell command that must exit 0
+}
+
+// TextCriteria builds criteria without checks from plain strings
+func TextCriteria(texts ...string) []Criterion {
+	criteria := make([]Criterion, 0, len(texts))
+	for _, t := range texts {
+		criteria = append(criteria, Criterion{Text: t})
+	}
+	return criteria
+}
+
+// String returns the criterion text, so templates can print it directly
+func (c Criterion) String() string {
+	return c.Text
+}
+
+// Describe returns the text followed by the check command, if any
+func (c Criterion) Describe() string {
+	if c.Check == "" {
+		return c.Text
+	}
+	return fmt.Sprintf("%s [check: %s]", c.Text, c.Check)
+}
+
+// MarshalJSON writes criteria without a check as plain strings so PRDs that
+// never use checks keep their original format
+func (c Criterion) MarshalJSON() ([]byte, error) {
+	if c.Check == "" {
+		return json.Marshal(c.Text)
+	}
+	type criterion Criterion
+	return json.Marshal(criterion(c))
+}
+
+// UnmarshalJSON accepts either a plain string or a {"text", "check"} object
+func (c *Criterion) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = Criterion{Text: text}
+		return nil
+	}
+
+	type criterion Criterion
+	var obj criterion
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("acceptance criterion must be a string or an object with text and check: %w", err)
+	}
+	*c = Criterion(obj)
+	return nil
+}
+
+// Checks returns the criteria of the story that carry a check command
+func (s *UserStory) Checks() []Criterion {
+	var checks []Criterion
+	for _, c := range s.AcceptanceCriteria {
+		if c.Check != "" {
+			checks = append(checks, c)
+		}
+	}
+	return checks
+}
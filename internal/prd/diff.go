@@ -0,0 +1,90 @@
+package prd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Change describes a single difference between two versions of a PRD
+type Change struct {
+	StoryID string // empty for PRD-level fields
+	Field   string // field name, or "added"/"removed" for whole stories
+	Before  string
+	After   string
+}
+
+// String formats the change for display
+func (c Change) String() string {
+	switch c.Field {
+	case "added":
+		return fmt.Sprintf("+ %s added: %s", c.StoryID, c.After)
+	case "removed":
+		return fmt.Sprintf("- %s removed: %s", c.StoryID, c.Before)
+	}
+	if c.StoryID == "" {
+		return fmt.Sprintf("~ %s: %q -> %q", c.Field, c.Before, c.After)
+	}
+	return fmt.Sprintf("~ %s %s: %q -> %q", c.StoryID, c.Field, c.Before, c.After)
+}
+
+// Diff returns the changes between two versions of a PRD, in story order
+func Diff(before, after *PRD) []Change {
+	var changes []Change
+
+	if before.BranchName != after.BranchName {
+		changes = append(changes, Change{Field: "branchName", Before: before.BranchName, After: after.BranchName})
+	}
+
+	for _, old := range before.UserStories {
+		updated := after.GetStory(old.ID)
+		if updated == nil {
+			changes = append(changes, Change{StoryID: old.ID, Field: "removed", Before: old.Title})
+			continue
+		}
+		changes = append(changes, diffStory(&old, updated)...)
+	}
+
+	for _, s := range after.UserStories {
+		if before.GetStory(s.ID) == nil {
+			changes = append(changes, Change{StoryID: s.ID, Field: "added", After: s.Title})
+		}
+	}
+
+	return changes
+}
+
+// diffStory compares the fields of two versions of the same story
+func diffStory(a, b *UserStory) []Change {
+	fields := []struct {
+		name          string
+		before, after string
+	}{
+		{"title", a.Title, b.Title},
+		{"description", a.Description, b.Description},
+		{"priority", strconv.Itoa(a.Priority), strconv.Itoa(b.Priority)},
+		{"dependsOn", strings.Join(a.DependsOn, ", "), strings.Join(b.DependsOn, ", ")},
+		{"promptTemplate", a.PromptTemplate, b.PromptTemplate},
+		{"acceptanceCriteria", describeCriteria(a.AcceptanceCriteria), describeCriteria(b.AcceptanceCriteria)},
+		{"passes", strconv.FormatBool(a.Passes), strconv.FormatBool(b.Passes)},
+		{"blocked", strconv.FormatBool(a.Blocked), strconv.FormatBool(b.Blocked)},
+		{"notes", a.Notes, b.Notes},
+	}
+
+	var changes []Change
+	for _, f := range fields {
+		if f.before != f.after {
+			changes = append(changes, Change{StoryID: a.ID, Field: f.name, Before: f.before, After: f.after})
+		}
+	}
+	return changes
+}
+
+// describeCriteria joins criteria, including their checks, for comparison
+func describeCriteria(criteria []Criterion) string {
+	parts := make([]string, len(criteria))
+	for i, c := range criteria {
+		parts[i] = c.Describe()
+	}
+	return strings.Join(parts, "; ")
+}
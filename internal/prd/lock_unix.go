@@ -0,0 +1,30 @@
+//go:build !windows
+
+package prd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory lock on the directory containing path,
+// blocking until it is available, and returns a function that releases it.
+// The directory is locked rather than the file because Save replaces the file.
+func lockFile(path string) (func(), error) {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PRD directory: %w", err)
+	}
+
+	if err := syscall.Flock(int(dir.Fd()), syscall.LOCK_EX); err != nil {
+		dir.Close()
+		return nil, fmt.Errorf("failed to lock PRD: %w", err)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(dir.Fd()), syscall.LOCK_UN)
+		dir.Close()
+	}, nil
+}
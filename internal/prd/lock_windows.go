@@ -0,0 +1,14 @@
+//go:build windows
+
+package prd
+
+import "sync"
+
+var fileLock sync.Mutex
+
+// lockFile serializes PRD updates within this process. Advisory file locks
+// are not used on Windows.
+func lockFile(path string) (func(), error) {
+	fileLock.Lock()
+	return fileLock.Unlock, nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -17,13 +18,16 @@ type PRD struct {
 
 // UserStory represents a single user story/task
 type UserStory struct {
-	ID                 string   `json:"id"`
-	Title              string   `json:"title"`
-	Description        string   `json:"description,omitempty"`
-	AcceptanceCriteria []string `json:"acceptanceCriteria"`
-	Priority           int      `json:"priority"`
-	Passes             bool     `json:"passes"`
-	Notes              string   `json:"notes,omitempty"`
+	ID                 string      `json:"id"`
+	Title              string      `json:"title"`
+	Description        string      `json:"description,omitempty"`
+	AcceptanceCriteria []Criterion `json:"acceptanceCriteria"`
+	Priority           int         `json:"priority"`
+	DependsOn          []string    `json:"dependsOn,omitempty"`      // IDs of stories that must pass first
+	PromptTemplate     string      `json:"promptTemplate,omitempty"` // template in the prompts directory used instead of the main prompt
+	Passes             bool        `json:"passes"`
+	Blocked            bool        `json:"blocked,omitempty"` // set when Ralph gave up on the story
+	Notes              string      `json:"notes,omitempty"`
 }
 
 // Load reads a PRD from a JSON file
@@ -33,28 +37,151 @@ func Load(path string) (*PRD, error) {
 		return nil, fmt.Errorf("failed to read PRD file: %w", err)
 	}
 
+	prd, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := prd.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid PRD: %w", err)
+	}
+
+	return prd, nil
+}
+
+// Parse decodes PRD JSON without validating it
+func Parse(data []byte) (*PRD, error) {
 	var prd PRD
 	if err := json.Unmarshal(data, &prd); err != nil {
 		return nil, fmt.Errorf("failed to parse PRD JSON: %w", err)
 	}
-
 	return &prd, nil
 }
 
-// Save writes the PRD to a JSON file
+// Validate checks story dependencies for unknown references and cycles
+func (p *PRD) Validate() error {
+	for _, s := range p.UserStories {
+		for _, dep := range s.DependsOn {
+			if strings.EqualFold(dep, s.ID) {
+				return fmt.Errorf("story %s depends on itself", s.ID)
+			}
+			if p.GetStory(dep) == nil {
+				return fmt.Errorf("story %s depends on unknown story %s", s.ID, dep)
+			}
+		}
+	}
+
+	// Depth-first search for cycles, tracking the current path for the error
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+
+	var visit func(id string) error
+	visit = func(id string) error {
+		id = strings.ToUpper(id)
+		switch state[id] {
+		case visiting:
+			start := 0
+			for i, visitedID := range path {
+				if visitedID == id {
+					start = i
+				}
+			}
+			cycle := append(append([]string{}, path[start:]...), id)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+
+		state[id] = visiting
+		path = append(path, id)
+		for _, dep := range p.GetStory(id).DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+		return nil
+	}
+
+	for _, s := range p.UserStories {
+		if err := visit(s.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Save writes the PRD to a JSON file. The file is replaced atomically so
+// readers never observe a partially written PRD.
 func (p *PRD) Save(path string) error {
 	data, err := json.MarshalIndent(p, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal PRD: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := writeFileAtomic(path, data); err != nil {
 		return fmt.Errorf("failed to write PRD file: %w", err)
 	}
 
 	return nil
 }
 
+// writeFileAtomic writes data to path through a temporary file that is then
+// renamed over it, so an interrupted or concurrent write never leaves the file
+// truncated
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Update loads the PRD at path, applies fn and saves the result while holding
+// an exclusive lock, so concurrent writers don't overwrite each other
+func Update(path string, fn func(*PRD) error) (*PRD, error) {
+	unlock, err := lockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	p, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+
+	if err := p.Save(path); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
 // NewPRD creates a new empty PRD
 func NewPRD(branchName string) *PRD {
 	return &PRD{
@@ -101,6 +228,7 @@ func (p *PRD) MarkDone(id string) error {
 		return fmt.Errorf("story %s not found", id)
 	}
 	story.Passes = true
+	story.Blocked = false
 	return nil
 }
 
@@ -111,6 +239,23 @@ func (p *PRD) MarkPending(id string) error {
 		return fmt.Errorf("story %s not found", id)
 	}
 	story.Passes = false
+	story.Blocked = false
+	return nil
+}
+
+// MarkBlocked marks a story as blocked and appends a note explaining why
+func (p *PRD) MarkBlocked(id, note string) error {
+	story := p.GetStory(id)
+	if story == nil {
+		return fmt.Errorf("story %s not found", id)
+	}
+	story.Blocked = true
+	if note != "" {
+		if story.Notes != "" {
+			story.Notes += " "
+		}
+		story.Notes += note
+	}
 	return nil
 }
 
@@ -148,9 +293,50 @@ func (p *PRD) CompletedStories() []UserStory {
 	return completed
 }
 
-// NextStory returns the highest priority pending story
+// BlockedStories returns all pending stories that have been marked as blocked
+func (p *PRD) BlockedStories() []UserStory {
+	var blocked []UserStory
+	for _, s := range p.UserStories {
+		if !s.Passes && s.Blocked {
+			blocked = append(blocked, s)
+		}
+	}
+	return blocked
+}
+
+// UnmetDependencies returns the IDs of a story's dependencies that have not passed
+func (p *PRD) UnmetDependencies(s *UserStory) []string {
+	var unmet []string
+	for _, dep := range s.DependsOn {
+		if d := p.GetStory(dep); d == nil || !d.Passes {
+			unmet = append(unmet, dep)
+		}
+	}
+	return unmet
+}
+
+// IsReady returns true if a story is pending, not blocked, and all of its
+// dependencies pass
+func (p *PRD) IsReady(s *UserStory) bool {
+	return !s.Passes && !s.Blocked && len(p.UnmetDependencies(s)) == 0
+}
+
+// NextStory returns the highest priority ready story (pending, not blocked,
+// and with all dependencies passing)
 func (p *PRD) NextStory() *UserStory {
-	pending := p.PendingStories()
+	return p.NextStoryExcluding(nil)
+}
+
+// NextStoryExcluding returns the highest priority ready story whose ID is not
+// in the exclude set
+func (p *PRD) NextStoryExcluding(exclude map[string]bool) *UserStory {
+	var pending []UserStory
+	for _, s := range p.PendingStories() {
+		if !p.IsReady(&s) || exclude[strings.ToUpper(s.ID)] {
+			continue
+		}
+		pending = append(pending, s)
+	}
 	if len(pending) == 0 {
 		return nil
 	}
@@ -218,12 +404,12 @@ func DefaultPRD() *PRD {
 				ID:          "US-001",
 				Title:       "Example user story",
 				Description: "Describe what this story accomplishes",
-				AcceptanceCriteria: []string{
+				AcceptanceCriteria: TextCriteria(
 					"First acceptance criterion",
 					"Second acceptance criterion",
 					"typecheck passes",
 					"tests pass",
-				},
+				),
 				Priority: 1,
 				Passes:   false,
 				Notes:    "",
@@ -237,6 +423,8 @@ func (s *UserStory) FormatForDisplay() string {
 	status := "[ ]"
 	if s.Passes {
 		status = "[x]"
+	} else if s.Blocked {
+		status = "[!]"
 	}
 
 	var sb strings.Builder
@@ -249,10 +437,18 @@ func (s *UserStory) FormatForDisplay() string {
 	if len(s.AcceptanceCriteria) > 0 {
 		sb.WriteString("    Acceptance Criteria:\n")
 		for _, ac := range s.AcceptanceCriteria {
-			sb.WriteString(fmt.Sprintf("      - %s\n", ac))
+			sb.WriteString(fmt.Sprintf("      - %s\n", ac.Describe()))
 		}
 	}
 
+	if len(s.DependsOn) > 0 {
+		sb.WriteString(fmt.Sprintf("    Depends on: %s\n", strings.Join(s.DependsOn, ", ")))
+	}
+
+	if s.PromptTemplate != "" {
+		sb.WriteString(fmt.Sprintf("    Prompt template: %s\n", s.PromptTemplate))
+	}
+
 	if s.Notes != "" {
 		sb.WriteString(fmt.Sprintf("    Notes: %s\n", s.Notes))
 	}
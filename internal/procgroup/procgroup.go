@@ -0,0 +1,19 @@
+// Package procgroup runs commands in a process group of their own, so that
+// stopping a command also stops the processes it started, such as test
+// runners and dev servers, and a Ctrl+C meant for Ralph does not reach them.
+package procgroup
+
+import "time"
+
+// minWaitDelay is the least time Wait waits for a command's output to be
+// closed once the command exited or was stopped. Without it a grace period of
+// 0 would let a leftover process holding the output hang Wait for good.
+const minWaitDelay = time.Second
+
+// waitDelay returns the exec.Cmd.WaitDelay for a grace period
+func waitDelay(grace time.Duration) time.Duration {
+	if grace < minWaitDelay {
+		return minWaitDelay
+	}
+	return grace
+}
@@ -0,0 +1,49 @@
+//go:build !windows
+
+package procgroup
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Configure starts cmd, which must be created with exec.CommandContext, in a
+// new process group. When its context is done the whole group receives
+// SIGINT, and SIGKILL if it is still running after grace. The returned
+// function must be called once Wait has returned: it kills what is left of an
+// interrupted group right away and stops the pending SIGKILL, so it cannot
+// reach a process group that later reuses the ID.
+func Configure(cmd *exec.Cmd, grace time.Duration) func() {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+
+	var mu sync.Mutex
+	var kill *time.Timer
+	cmd.Cancel = func() error {
+		pgid := cmd.Process.Pid
+		err := syscall.Kill(-pgid, syscall.SIGINT)
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+		mu.Lock()
+		kill = time.AfterFunc(grace, func() { _ = syscall.Kill(-pgid, syscall.SIGKILL) })
+		mu.Unlock()
+		return err
+	}
+	// Wait gives up on a leader that ignores SIGINT at the same time
+	cmd.WaitDelay = waitDelay(grace)
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if kill != nil && kill.Stop() {
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+	}
+}
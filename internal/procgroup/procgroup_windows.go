@@ -0,0 +1,17 @@
+//go:build windows
+
+package procgroup
+
+import (
+	"os/exec"
+	"time"
+)
+
+// Configure bounds how long Wait takes once cmd's context is done. Windows
+// has no signal to interrupt a process with, so cmd itself is killed right
+// away; processes it started are not. The returned function, to be called
+// once Wait has returned, does nothing here.
+func Configure(cmd *exec.Cmd, grace time.Duration) func() {
+	cmd.WaitDelay = waitDelay(grace)
+	return func() {}
+}
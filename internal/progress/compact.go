@@ -0,0 +1,180 @@
+package progress
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SummaryHeading is the heading of the section Compact folds old entries into
+const SummaryHeading = "Earlier Progress"
+
+// Summarizer writes the summary of folded entries. previous is the body of the
+// summary written by an earlier compaction, or empty.
+type Summarizer func(previous string, entries []Entry) (string, error)
+
+// Compact folds all story entries but the last keep into a summary section
+// written by summarize. The preamble and every other section, such as
+// "## Codebase Patterns" and "## Key Files", are kept verbatim. It returns the
+// number of entries folded; with nothing to fold the content is left unchanged.
+func (p *Progress) Compact(keep int, summarize Summarizer) (int, error) {
+	if keep < 0 {
+		keep = 0
+	}
+
+	log := Parse(p.Content)
+	var kept []string
+	var previous string
+	var entries []Section
+	for _, s := range log.Sections {
+		switch {
+		case s.Heading == SummaryHeading:
+			previous = sectionBody(s.Text)
+		case s.Entry == nil:
+			kept = append(kept, s.Text)
+		default:
+			entries = append(entries, s)
+		}
+	}
+
+	if len(entries) <= keep {
+		return 0, nil
+	}
+	folded := entries[:len(entries)-keep]
+	recent := entries[len(entries)-keep:]
+
+	parsed := make([]Entry, len(folded))
+	for i, s := range folded {
+		parsed[i] = *s.Entry
+	}
+	summary, err := summarize(previous, parsed)
+	if err != nil {
+		return 0, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(log.Preamble)
+	for _, text := range kept {
+		sb.WriteString(text)
+	}
+	if !strings.HasSuffix(sb.String(), "\n") {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(fmt.Sprintf("## %s\n\n%s\n\n---\n", SummaryHeading, strings.TrimSpace(summary)))
+	for _, s := range recent {
+		if !strings.HasSuffix(sb.String(), "\n\n") {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(s.Text)
+	}
+
+	p.Content = sb.String()
+	return len(folded), nil
+}
+
+// Summarize is the built-in Summarizer. It keeps one line per story with its
+// learnings and notes, and drops the rest of each entry, such as the files
+// changed.
+func Summarize(previous string, entries []Entry) (string, error) {
+	var sb strings.Builder
+	if previous = strings.TrimSpace(previous); previous != "" {
+		sb.WriteString(previous)
+		sb.WriteString("\n")
+	}
+
+	// Group entries of the same story, keeping the order they were written in
+	type story struct {
+		line      string
+		learnings []string
+	}
+	var order []string
+	stories := make(map[string]*story)
+	for _, e := range entries {
+		key := strings.ToUpper(e.StoryID)
+		s, ok := stories[key]
+		if !ok {
+			s = &story{}
+			stories[key] = s
+			order = append(order, key)
+		}
+		s.line = summaryLine(e)
+		for _, list := range [][]string{e.Learnings, e.Notes} {
+			for _, l := range list {
+				if !contains(s.learnings, l) {
+					s.learnings = append(s.learnings, l)
+				}
+			}
+		}
+	}
+
+	for _, key := range order {
+		s := stories[key]
+		sb.WriteString(s.line)
+		sb.WriteString("\n")
+		for _, l := range s.learnings {
+			sb.WriteString("  - ")
+			sb.WriteString(l)
+			sb.WriteString("\n")
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// Archive writes the current content to dir as progress-<timestamp>.txt and
+// returns its path
+func (p *Progress) Archive(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	base := "progress-" + time.Now().Format("20060102-150405")
+	path := filepath.Join(dir, base+".txt")
+	for i := 2; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d.txt", base, i))
+	}
+
+	if err := os.WriteFile(path, []byte(p.Content), 0644); err != nil {
+		return "", fmt.Errorf("failed to archive progress file: %w", err)
+	}
+	return path, nil
+}
+
+// summaryLine describes an entry in one line, e.g.
+// "- US-001 - Add login form (2026-01-16 15:04)"
+func summaryLine(e Entry) string {
+	line := "- " + e.StoryID
+	if e.Title != "" {
+		line += " - " + e.Title
+	}
+	if !e.Time.IsZero() {
+		line += " (" + e.Time.Format("2006-01-02 15:04") + ")"
+	}
+	return line
+}
+
+// sectionBody returns a section's text without its heading and trailing
+// separator
+func sectionBody(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[i+1:]
+	} else {
+		text = ""
+	}
+	text = strings.TrimSpace(text)
+	return strings.TrimSpace(strings.TrimSuffix(text, "---"))
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
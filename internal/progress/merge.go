@@ -0,0 +1,134 @@
+package progress
+
+import "strings"
+
+// Merge adds to the log what updated adds to base, an earlier version of the
+// updated log. Sections only updated has are inserted before the section that
+// follows them there, or appended. Lines added to a section both have, such as
+// new codebase patterns, are added to the end of that section here. Lines the
+// log already has are not repeated.
+func (l *Log) Merge(base, updated *Log) {
+	baseSections := make(map[string]string, len(base.Sections))
+	for _, s := range base.Sections {
+		baseSections[s.Heading] = s.Text
+	}
+
+	// The preamble is merged like a section
+	l.Preamble = addLines(l.Preamble, newLines(base.Preamble, updated.Preamble, l.Preamble))
+
+	for i, s := range updated.Sections {
+		baseText, inBase := baseSections[s.Heading]
+		j := l.section(s.Heading)
+
+		if !inBase {
+			if j >= 0 {
+				continue
+			}
+			next := -1
+			for _, after := range updated.Sections[i+1:] {
+				if next = l.section(after.Heading); next >= 0 {
+					break
+				}
+			}
+			l.insert(next, s.Text)
+			continue
+		}
+
+		if j < 0 {
+			if added := newLines(baseText, s.Text, ""); len(added) > 0 {
+				l.insert(-1, "## "+s.Heading+"\n"+strings.Join(added, "\n")+"\n")
+			}
+			continue
+		}
+		if added := newLines(baseText, s.Text, l.Sections[j].Text); len(added) > 0 {
+			l.Sections[j].Text = addLines(l.Sections[j].Text, added)
+			l.Sections[j].Entry = parseEntry(l.Sections[j])
+		}
+	}
+}
+
+// section returns the index of the section with the given heading, or -1
+func (l *Log) section(heading string) int {
+	for i, s := range l.Sections {
+		if s.Heading == heading {
+			return i
+		}
+	}
+	return -1
+}
+
+// insert adds a section with the given text before the section at index i, or
+// at the end if i is negative
+func (l *Log) insert(i int, text string) {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	s := Section{Heading: strings.TrimSpace(strings.SplitN(text, "\n", 2)[0][3:]), Text: text}
+	s.Entry = parseEntry(s)
+
+	if i < 0 {
+		// Keep a blank line between the last section and the new one
+		if n := len(l.Sections); n > 0 {
+			l.Sections[n-1].Text = separate(l.Sections[n-1].Text)
+		} else if l.Preamble != "" {
+			l.Preamble = separate(l.Preamble)
+		}
+		l.Sections = append(l.Sections, s)
+		return
+	}
+	l.Sections = append(l.Sections[:i], append([]Section{s}, l.Sections[i:]...)...)
+}
+
+// separate makes text end with a blank line
+func separate(text string) string {
+	for !strings.HasSuffix(text, "\n\n") {
+		text += "\n"
+	}
+	return text
+}
+
+// newLines returns the non-blank lines of updated that are neither in base nor
+// in current
+func newLines(base, updated, current string) []string {
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(base+"\n"+current, "\n") {
+		seen[strings.TrimSpace(line)] = true
+	}
+
+	var added []string
+	for _, line := range strings.Split(updated, "\n") {
+		key := strings.TrimSpace(line)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		added = append(added, strings.TrimRight(line, " \t\r"))
+	}
+	return added
+}
+
+// addLines inserts lines after the last line of text that is neither blank nor
+// a "---" separator
+func addLines(text string, lines []string) string {
+	if len(lines) == 0 {
+		return text
+	}
+
+	all := strings.Split(text, "\n")
+	at := len(all)
+	for at > 0 {
+		if line := strings.TrimSpace(all[at-1]); line != "" && line != "---" {
+			break
+		}
+		at--
+	}
+
+	out := append([]string{}, all[:at]...)
+	out = append(out, lines...)
+	out = append(out, all[at:]...)
+	result := strings.Join(out, "\n")
+	if at == len(all) && !strings.HasSuffix(result, "\n") {
+		result += "\n"
+	}
+	return result
+}
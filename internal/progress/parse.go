@@ -0,0 +1,145 @@
+package progress
+
+import (
+	"strings"
+	"time"
+)
+
+// entryTimeLayouts are the timestamp formats accepted in entry headings
+var entryTimeLayouts = []string{
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02",
+}
+
+// Entry is a story entry of the progress log, written as
+// "## [Date] - [Story ID]" followed by the title, files changed and learnings
+type Entry struct {
+	Heading      string    `json:"heading"`        // heading line without the leading "## "
+	Time         time.Time `json:"time,omitempty"` // zero if the heading's date did not parse
+	StoryID      string    `json:"storyId"`
+	Title        string    `json:"title,omitempty"`        // bold line under the heading
+	FilesChanged []string  `json:"filesChanged,omitempty"` // bullets under "Files changed:"
+	Learnings    []string  `json:"learnings,omitempty"`    // bullets under "**Learnings:**"
+	Notes        []string  `json:"notes,omitempty"`        // notes appended with 'ralph log --append'
+	Text         string    `json:"-"`                      // the entry as written, heading included
+}
+
+// Section is a "## " section of the progress log
+type Section struct {
+	Heading string // heading line without the leading "## "
+	Text    string // the section as written, heading included
+	Entry   *Entry // the parsed entry, or nil for a free-form section
+}
+
+// Log is a parsed progress log. It keeps the text of every section, so
+// free-form sections the parser does not understand survive a round trip.
+type Log struct {
+	Preamble string // text before the first "## " heading
+	Sections []Section
+}
+
+// Parse splits progress log content into sections and parses story entries
+func Parse(content string) *Log {
+	log := &Log{}
+	var preamble strings.Builder
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if strings.HasPrefix(line, "## ") {
+			log.Sections = append(log.Sections, Section{Heading: strings.TrimSpace(line[3:])})
+		}
+		if len(log.Sections) == 0 {
+			preamble.WriteString(line)
+		} else {
+			log.Sections[len(log.Sections)-1].Text += line
+		}
+	}
+	log.Preamble = preamble.String()
+
+	for i := range log.Sections {
+		log.Sections[i].Entry = parseEntry(log.Sections[i])
+	}
+	return log
+}
+
+// String returns the log as text, exactly as it was parsed
+func (l *Log) String() string {
+	var sb strings.Builder
+	sb.WriteString(l.Preamble)
+	for _, s := range l.Sections {
+		sb.WriteString(s.Text)
+	}
+	return sb.String()
+}
+
+// Entries returns the story entries in the order they were written
+func (l *Log) Entries() []Entry {
+	var entries []Entry
+	for _, s := range l.Sections {
+		if s.Entry != nil {
+			entries = append(entries, *s.Entry)
+		}
+	}
+	return entries
+}
+
+// FilterEntries returns the entries of the given stories, keeping their
+// order. Story IDs are matched case-insensitively.
+func FilterEntries(entries []Entry, storyIDs ...string) []Entry {
+	var filtered []Entry
+	for _, e := range entries {
+		for _, id := range storyIDs {
+			if strings.EqualFold(e.StoryID, id) {
+				filtered = append(filtered, e)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// Entries parses the progress file's story entries
+func (p *Progress) Entries() []Entry {
+	return Parse(p.Content).Entries()
+}
+
+// parseEntry parses a section headed "[Date] - [Story ID]". It returns nil for
+// any other section.
+func parseEntry(s Section) *Entry {
+	date, id, ok := strings.Cut(s.Heading, " - ")
+	id = strings.TrimSpace(id)
+	if !ok || id == "" || strings.ContainsAny(id, " \t") {
+		return nil
+	}
+
+	e := &Entry{Heading: s.Heading, StoryID: id, Text: s.Text}
+	date = strings.Trim(strings.TrimSpace(date), "[]")
+	for _, layout := range entryTimeLayouts {
+		if t, err := time.ParseInLocation(layout, date, time.Local); err == nil {
+			e.Time = t
+			break
+		}
+	}
+
+	// list is the bullet list being read, if any
+	var list *[]string
+	for _, line := range strings.Split(s.Text, "\n")[1:] {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "Files changed:" || line == "**Files changed:**":
+			list = &e.FilesChanged
+		case line == "**Learnings:**" || line == "Learnings:":
+			list = &e.Learnings
+		case list != nil && strings.HasPrefix(line, "- "):
+			*list = append(*list, strings.TrimPrefix(line, "- "))
+		case strings.HasPrefix(line, "**Note:**"):
+			e.Notes = append(e.Notes, strings.TrimSpace(strings.TrimPrefix(line, "**Note:**")))
+			list = nil
+		case line == "" || line == "---":
+			list = nil
+		case e.Title == "" && len(line) > 4 && strings.HasPrefix(line, "**") && strings.HasSuffix(line, "**"):
+			e.Title = strings.Trim(line, "*")
+		}
+	}
+	return e
+}
@@ -0,0 +1,99 @@
+package prompt
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/template"
+
+	"github.com/kylemclaren/ralph/internal/git"
+	"github.com/kylemclaren/ralph/internal/prd"
+)
+
+// FuncMap returns the helper functions available to prompt templates:
+//
+//	pending STORIES         stories that do not pass yet
+//	done STORIES            stories that pass
+//	storiesByPriority LIST  stories sorted by priority, highest (1) first
+//	truncate N TEXT         TEXT cut to at most N characters
+//	readFile PATH           contents of a file, empty if it does not exist
+//	gitLog N                the last N commits, one per line
+//	gitDiffStat             a summary of uncommitted changes
+//
+// The git helpers return an empty string outside a git repository.
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"pending":           pending,
+		"done":              done,
+		"storiesByPriority": storiesByPriority,
+		"truncate":          truncate,
+		"readFile":          readFile,
+		"gitLog":            gitLog,
+		"gitDiffStat":       gitDiffStat,
+	}
+}
+
+func pending(stories []prd.UserStory) []prd.UserStory {
+	var result []prd.UserStory
+	for _, s := range stories {
+		if !s.Passes {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func done(stories []prd.UserStory) []prd.UserStory {
+	var result []prd.UserStory
+	for _, s := range stories {
+		if s.Passes {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func storiesByPriority(stories []prd.UserStory) []prd.UserStory {
+	sorted := append([]prd.UserStory(nil), stories...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+	return sorted
+}
+
+// truncate takes the text last so it can end a pipeline:
+// {{.Progress | truncate 2000}}
+func truncate(n int, text string) string {
+	runes := []rune(text)
+	if n < 0 || len(runes) <= n {
+		return text
+	}
+	return string(runes[:n]) + "\n... (truncated)"
+}
+
+func readFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("readFile %s: %w", path, err)
+	}
+	return string(data), nil
+}
+
+func gitLog(n int) string {
+	out, err := git.Log(".", n)
+	if err != nil {
+		return ""
+	}
+	return out
+}
+
+func gitDiffStat() string {
+	out, err := git.DiffStat(".")
+	if err != nil {
+		return ""
+	}
+	return out
+}
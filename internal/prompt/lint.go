@@ -0,0 +1,218 @@
+package prompt
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kylemclaren/ralph/internal/prd"
+	"github.com/kylemclaren/ralph/internal/progress"
+)
+
+// CompletionMarker is what the default completion pattern looks for at the end
+// of the agent's output once every story passes
+const CompletionMarker = "<promise>COMPLETE</promise>"
+
+// Diagnostic is a problem found in a prompt template
+type Diagnostic struct {
+	Path    string // template file
+	Line    int    // 0 if unknown
+	Col     int    // 0 if unknown
+	Message string
+	Warning bool // the template works, but probably not as intended
+}
+
+// String formats the diagnostic as "path:line:col: message"
+func (d Diagnostic) String() string {
+	pos := d.Path
+	if d.Line > 0 {
+		pos += ":" + strconv.Itoa(d.Line)
+		if d.Col > 0 {
+			pos += ":" + strconv.Itoa(d.Col)
+		}
+	}
+	return pos + ": " + d.Message
+}
+
+// templateErrorRe matches the position text/template puts in its errors, e.g.
+// `template: prompt.md:12:4: executing "prompt.md" at <.NextStroy>: ...`
+var templateErrorRe = regexp.MustCompile(`template: ([^:\s]+):(\d+)(?::(\d+))?: (?:executing "[^"]*" )?(.*)$`)
+
+// SampleData returns template data with every field set, so rendering it runs
+// the body of each {{with}}, {{if}} and {{range}} on a field
+func SampleData() TemplateData {
+	story := prd.UserStory{
+		ID:                 "US-002",
+		Title:              "Sample story",
+		Description:        "As a user, I want a sample story",
+		AcceptanceCriteria: []prd.Criterion{{Text: "Tests pass", Check: "go test ./..."}},
+		Priority:           2,
+		DependsOn:          []string{"US-001"},
+		Notes:              "Sample notes",
+	}
+	done := prd.UserStory{
+		ID:                 "US-001",
+		Title:              "Completed story",
+		Description:        "As a user, I want a completed story",
+		AcceptanceCriteria: []prd.Criterion{{Text: "Builds"}},
+		Priority:           1,
+		Passes:             true,
+	}
+	entry := progress.Entry{
+		Heading:      "2026-01-01 12:00 - US-001",
+		Time:         time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local),
+		StoryID:      "US-001",
+		Title:        "Completed story",
+		FilesChanged: []string{"main.go"},
+		Learnings:    []string{"Sample learning"},
+		Notes:        []string{"Sample note"},
+		Text:         "## 2026-01-01 12:00 - US-001\n**Completed story**\n",
+	}
+
+	return TemplateData{
+		PRD:            `{"project": "Sample"}`,
+		Progress:       "# Ralph Progress Log\n",
+		BranchName:     "ralph/sample",
+		PendingCount:   1,
+		CompletedCount: 1,
+		TotalCount:     2,
+		NextStory:      &story,
+		FailedChecks: []prd.CheckFailure{{
+			Criterion: "Tests pass",
+			Command:   "go test ./...",
+			ExitCode:  1,
+			Output:    "FAIL",
+			Error:     "exit status 1",
+		}},
+		Entries:                  []progress.Entry{entry},
+		StoryEntries:             []progress.Entry{entry},
+		Stories:                  []prd.UserStory{done, story},
+		Iteration:                2,
+		MaxIterations:            10,
+		PreviousIterationSummary: "Iteration 1 (US-001 - Completed story): success, exit code 0",
+		CodebasePatterns:         "- Sample pattern",
+		LastFailure:              "Sample failure",
+	}
+}
+
+// Validate parses the main template and the templates named by stories, then
+// renders each against SampleData in strict mode. It reports templates that do
+// not parse, fields, keys and partials that do not exist, and stories whose
+// promptTemplate is missing.
+func (s *Set) Validate(stories []prd.UserStory) []Diagnostic {
+	names := []string{""}
+	missing := make(map[string][]string)
+	for i := range stories {
+		name := stories[i].PromptTemplate
+		if name == "" {
+			continue
+		}
+		if _, ok := s.Templates[name]; !ok {
+			if len(missing[name]) == 0 {
+				names = append(names, name)
+			}
+			missing[name] = append(missing[name], stories[i].ID)
+			continue
+		}
+		if !containsName(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	var diags []Diagnostic
+	for _, name := range names {
+		if ids := missing[name]; len(ids) > 0 {
+			diags = append(diags, Diagnostic{
+				Path:    s.Path(name),
+				Message: fmt.Sprintf("template does not exist, but %s use(s) it as promptTemplate", strings.Join(ids, ", ")),
+			})
+			continue
+		}
+
+		tmpl, err := s.Parse(name)
+		if err == nil {
+			err = tmpl.Execute(io.Discard, SampleData())
+		}
+		if err == nil {
+			continue
+		}
+		// A broken partial fails every template, but is reported once
+		d := s.diagnose(name, err)
+		if !containsDiagnostic(diags, d) {
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
+
+// Lint validates the templates like Validate and also warns about templates
+// that never mention marker, the completion marker the agent must print once
+// every story passes. An empty marker skips that check.
+func (s *Set) Lint(stories []prd.UserStory, marker string) []Diagnostic {
+	diags := s.Validate(stories)
+	if marker == "" {
+		return diags
+	}
+
+	names := []string{""}
+	for i := range stories {
+		name := stories[i].PromptTemplate
+		if _, ok := s.Templates[name]; ok && !containsName(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if !strings.Contains(s.Source(name), marker) {
+			diags = append(diags, Diagnostic{
+				Path: s.Path(name),
+				Message: fmt.Sprintf("never mentions %s, so the agent is not told how to end the loop "+
+					"and it only stops at maxIterations", marker),
+				Warning: true,
+			})
+		}
+	}
+	return diags
+}
+
+// diagnose turns a parse or execution error of template name into a
+// diagnostic, pointing at the file and position text/template reports
+func (s *Set) diagnose(name string, err error) Diagnostic {
+	d := Diagnostic{Path: s.Path(name), Message: err.Error()}
+	m := templateErrorRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return d
+	}
+
+	// The entry template is named after its file, partials after theirs
+	if m[1] != filepath.Base(s.Path(name)) {
+		if _, ok := s.Templates[m[1]]; ok {
+			d.Path = s.Path(m[1])
+		}
+	}
+	d.Line, _ = strconv.Atoi(m[2])
+	d.Col, _ = strconv.Atoi(m[3])
+	d.Message = m[4]
+	return d
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsDiagnostic(diags []Diagnostic, d Diagnostic) bool {
+	for _, v := range diags {
+		if v == d {
+			return true
+		}
+	}
+	return false
+}
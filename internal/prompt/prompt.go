@@ -19,6 +19,20 @@ type TemplateData struct {
 	CompletedCount int
 	TotalCount     int
 	NextStory      *prd.UserStory
+	FailedChecks   []prd.CheckFailure // acceptance checks that rejected the last attempt at NextStory
+	Entries        []progress.Entry   // parsed story entries of progress.txt
+	StoryEntries   []progress.Entry   // entries for NextStory and the stories it depends on
+	Stories        []prd.UserStory    // all stories in PRD order, for range and the story helpers
+	Iteration      int                // iteration the prompt is rendered for
+	MaxIterations  int
+
+	// PreviousIterationSummary describes the outcome of the previous
+	// iteration of this run, e.g. "Iteration 2 (US-001 - Add login form):
+	// no_progress, exit code 0. no story was marked as passing"
+	PreviousIterationSummary string
+
+	CodebasePatterns string // the "## Codebase Patterns" section of progress.txt
+	LastFailure      string // error and end of the output of this run's last failed iteration
 }
 
 // Load reads a prompt template from file
@@ -40,7 +54,7 @@ func Save(path, content string) error {
 
 // Render renders the prompt template with the given data
 func Render(templateContent string, data TemplateData) (string, error) {
-	tmpl, err := template.New("prompt").Parse(templateContent)
+	tmpl, err := template.New("prompt").Funcs(FuncMap()).Option("missingkey=error").Parse(templateContent)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse prompt template: %w", err)
 	}
@@ -61,6 +75,8 @@ func BuildTemplateData(p *prd.PRD, prog *progress.Progress) (TemplateData, error
 	}
 
 	total, completed, pending := p.Stats()
+	entries := prog.Entries()
+	next := p.NextStory()
 
 	return TemplateData{
 		PRD:            prdJSON,
@@ -69,10 +85,44 @@ func BuildTemplateData(p *prd.PRD, prog *progress.Progress) (TemplateData, error
 		PendingCount:   pending,
 		CompletedCount: completed,
 		TotalCount:     total,
-		NextStory:      p.NextStory(),
+		NextStory:      next,
+		Entries:        entries,
+		StoryEntries:   StoryEntries(entries, next),
+		Stories:        p.UserStories,
+
+		CodebasePatterns: prog.GetCodebasePatterns(),
 	}, nil
 }
 
+// StoryEntries returns the progress entries written for story and the stories
+// it depends on
+func StoryEntries(entries []progress.Entry, story *prd.UserStory) []progress.Entry {
+	if story == nil {
+		return nil
+	}
+	ids := append([]string{story.ID}, story.DependsOn...)
+	return progress.FilterEntries(entries, ids...)
+}
+
+// FailedChecksTemplate shows the acceptance checks that rejected the last
+// attempt at the story. It is part of the default prompt and appended to
+// custom prompts that do not reference .FailedChecks.
+const FailedChecksTemplate = `{{with .FailedChecks}}
+## Failed Acceptance Checks
+
+Your last attempt at this story was marked as passing, but Ralph ran its
+acceptance checks and these failed, so it was returned to pending. Fix them
+before marking the story as passing again.
+{{range .}}
+### {{.Criterion}}
+
+` + "`{{.Command}}`" + ` exited with code {{.ExitCode}}{{with .Error}} ({{.}}){{end}}:
+
+` + "```" + `
+{{.Output}}
+` + "```" + `
+{{end}}{{end}}`
+
 // DefaultPrompt returns the default Ralph prompt template
 func DefaultPrompt() string {
 	return `# Ralph Agent Instructions
@@ -81,7 +131,7 @@ You are Ralph, an autonomous coding agent working through a PRD (Product Require
 
 ## Your Task
 
-1. Read the PRD below and identify the highest priority story where ` + "`passes: false`" + `
+1. Read the PRD below and identify the highest priority story where ` + "`passes: false`" + `, ` + "`blocked`" + ` is not set, and every story in ` + "`dependsOn`" + ` passes{{with .NextStory}} (this iteration: ` + "`{{.ID}}`" + ` - {{.Title}}){{end}}
 2. Read the progress log for context and patterns from previous work
 3. Check you're on the correct branch: ` + "`{{.BranchName}}`" + `
 4. Implement that ONE story completely
@@ -110,6 +160,7 @@ You are Ralph, an autonomous coding agent working through a PRD (Product Require
 {{.Progress}}
 ` + "```" + `
 
+` + FailedChecksTemplate + `
 ## Progress Format
 
 When appending to progress.txt, use this format:
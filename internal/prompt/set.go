@@ -0,0 +1,135 @@
+package prompt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/kylemclaren/ralph/internal/prd"
+)
+
+// TemplateExt is the extension of the templates in the prompts directory
+const TemplateExt = ".md"
+
+// Set is the main prompt template together with the templates in the prompts
+// directory. Every template in the directory is available as a partial, e.g.
+// {{template "guidelines" .}} for prompts/guidelines.md, and can replace the
+// main template for stories that name it in promptTemplate.
+type Set struct {
+	Main      string            // content of the main prompt template
+	MainPath  string            // path of the main prompt template
+	Dir       string            // prompts directory
+	Templates map[string]string // template name -> content
+}
+
+// LoadSet reads the main prompt template and the templates in dir. A missing
+// dir yields no extra templates.
+func LoadSet(mainPath, dir string) (*Set, error) {
+	main, err := Load(mainPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Set{Main: main, MainPath: mainPath, Dir: dir, Templates: make(map[string]string)}
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+TemplateExt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt templates: %w", err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template: %w", err)
+		}
+		s.Templates[strings.TrimSuffix(filepath.Base(path), TemplateExt)] = string(data)
+	}
+
+	return s, nil
+}
+
+// Names returns the names of the templates in the prompts directory in
+// alphabetical order
+func (s *Set) Names() []string {
+	names := make([]string, 0, len(s.Templates))
+	for name := range s.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Path returns the file a template is read from; name "" is the main template
+func (s *Set) Path(name string) string {
+	if name == "" {
+		return s.MainPath
+	}
+	return filepath.Join(s.Dir, name+TemplateExt)
+}
+
+// TemplateFor returns the name of the template to render for a story: its
+// promptTemplate, or "" for the main template
+func (s *Set) TemplateFor(story *prd.UserStory) (string, error) {
+	if story == nil || story.PromptTemplate == "" {
+		return "", nil
+	}
+	if _, ok := s.Templates[story.PromptTemplate]; !ok {
+		return "", fmt.Errorf("story %s uses prompt template %q, but %s does not exist",
+			story.ID, story.PromptTemplate, s.Path(story.PromptTemplate))
+	}
+	return story.PromptTemplate, nil
+}
+
+// Source returns the text of a template and every partial it may include
+func (s *Set) Source(name string) string {
+	var sb strings.Builder
+	if name == "" {
+		sb.WriteString(s.Main)
+	}
+	for _, n := range s.Names() {
+		sb.WriteString(s.Templates[n])
+	}
+	return sb.String()
+}
+
+// Parse parses a template with all partials defined; name "" is the main
+// template. Indexing a map with a missing key is an error rather than
+// "<no value>".
+func (s *Set) Parse(name string) (*template.Template, error) {
+	entry := s.Main
+	if name != "" {
+		var ok bool
+		if entry, ok = s.Templates[name]; !ok {
+			return nil, fmt.Errorf("prompt template %q not found in %s", name, s.Dir)
+		}
+	}
+
+	// Name the root after its file so errors point at it
+	root := template.New(filepath.Base(s.Path(name))).Funcs(FuncMap()).Option("missingkey=error")
+	for _, n := range s.Names() {
+		if _, err := root.New(n).Parse(s.Templates[n]); err != nil {
+			return nil, fmt.Errorf("failed to parse prompt template %s: %w", s.Path(n), err)
+		}
+	}
+	if _, err := root.Parse(entry); err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template %s: %w", s.Path(name), err)
+	}
+	return root, nil
+}
+
+// Render renders a template with the given data; name "" is the main template
+func (s *Set) Render(name string, data TemplateData) (string, error) {
+	tmpl, err := s.Parse(name)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt: %w", err)
+	}
+
+	return buf.String(), nil
+}
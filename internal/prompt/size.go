@@ -0,0 +1,76 @@
+package prompt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// WarnSize is the rendered prompt size above which Ralph warns before
+	// running the agent
+	WarnSize = 100 * 1024
+
+	// MaxArgSize is the largest prompt that can be passed as a single
+	// command-line argument; Linux rejects longer arguments with "argument
+	// list too long"
+	MaxArgSize = 128*1024 - 1
+)
+
+// Section is a part of a rendered prompt and its size in bytes
+type Section struct {
+	Name  string
+	Bytes int
+}
+
+func (s Section) String() string {
+	return fmt.Sprintf("%s (%s)", s.Name, FormatSize(s.Bytes))
+}
+
+// Sections breaks a rendered prompt down into the template data that tends to
+// grow over a run, plus the rest of the template, largest first. Data the
+// template does not include is left out.
+func Sections(rendered string, data TemplateData) []Section {
+	var sections []Section
+	rest := len(rendered)
+	add := func(name, value string) {
+		if value == "" || !strings.Contains(rendered, value) {
+			return
+		}
+		sections = append(sections, Section{Name: name, Bytes: len(value)})
+		rest -= len(value)
+	}
+
+	add(".PRD", data.PRD)
+	add(".Progress", data.Progress)
+	failed := 0
+	for _, f := range data.FailedChecks {
+		if f.Output != "" && strings.Contains(rendered, f.Output) {
+			failed += len(f.Output)
+		}
+	}
+	if failed > 0 {
+		sections = append(sections, Section{Name: ".FailedChecks", Bytes: failed})
+		rest -= failed
+	}
+	if rest > 0 {
+		sections = append(sections, Section{Name: "template", Bytes: rest})
+	}
+
+	sort.SliceStable(sections, func(i, j int) bool {
+		return sections[i].Bytes > sections[j].Bytes
+	})
+	return sections
+}
+
+// FormatSize formats a byte count for display, e.g. 131072 -> "128.0 KB"
+func FormatSize(n int) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,26 @@
+// Package shell runs the command lines of hooks and acceptance checks through
+// the platform shell, and helps capture the output of the commands Ralph runs.
+package shell
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+)
+
+// Command returns a command that runs line through the platform shell
+func Command(ctx context.Context, line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", line)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", line)
+}
+
+// Tail returns at most the last n bytes of s, the end of a command's output
+// being where its errors usually are
+func Tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "...\n" + s[len(s)-n:]
+}
@@ -0,0 +1,26 @@
+package shell
+
+import (
+	"io"
+	"sync"
+)
+
+// SyncWriter serializes writes to w. os/exec copies a command's stdout and
+// stderr on separate goroutines, so a writer both of them share, such as a
+// buffer keeping the combined output, must be wrapped in one.
+type SyncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewSyncWriter returns a writer that serializes writes to w
+func NewSyncWriter(w io.Writer) *SyncWriter {
+	return &SyncWriter{w: w}
+}
+
+// Write writes p to the underlying writer while holding the lock
+func (s *SyncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}